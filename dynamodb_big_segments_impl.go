@@ -29,6 +29,10 @@ type dynamoDBBigSegmentStoreImpl struct {
 	cancelContext func()
 	table         string
 	prefix        string
+	tracer        *storeTracer
+	metrics       *storeMetrics
+	capacity      *capacityAccountant
+	apiOptions    []func(*dynamodb.Options)
 	loggers       ldlog.Loggers
 }
 
@@ -50,24 +54,49 @@ func newDynamoDBBigSegmentStoreImpl(
 		cancelContext: cancelContext,
 		table:         builder.table,
 		prefix:        builder.prefix,
+		tracer:        newStoreTracer(builder.tracer, "DynamoDBBigSegmentStore.", builder.table, builder.prefix),
+		metrics:       newStoreMetrics(builder.metrics, builder.table, builder.prefix),
+		capacity:      newCapacityAccountant(builder.capacityAccounting, builder.prefix),
 		loggers:       loggers, // copied by value so we can modify it
 	}
+	if store.tracer != nil {
+		store.apiOptions = append(store.apiOptions, addTracingMiddleware)
+	}
+	if store.metrics != nil {
+		store.apiOptions = append(store.apiOptions, store.metrics.addMiddleware)
+	}
 	store.loggers.SetPrefix("DynamoDBBigSegmentStoreStore:")
 	store.loggers.Infof(`Using DynamoDB table %s`, store.table)
+	if store.capacity != nil {
+		store.apiOptions = append(store.apiOptions, store.capacity.addMiddleware)
+		go store.capacity.logPeriodically(store.context, builder.capacityLogInterval, store.loggers)
+	}
+	slowLogger := newSlowOperationLogger(builder.slowOperationThreshold, store.table, store.loggers)
+	if slowLogger != nil {
+		store.apiOptions = append(store.apiOptions, slowLogger.addMiddleware)
+	}
 
 	return store, nil
 }
 
 func (store *dynamoDBBigSegmentStoreImpl) GetMetadata() (subsystems.BigSegmentStoreMetadata, error) {
+	ctx, span := store.tracer.start(store.context, "GetMetadata", "")
+	metadata, err := store.getMetadata(ctx)
+	err = classifyError(store.context, err)
+	span.end(err)
+	return metadata, err
+}
+
+func (store *dynamoDBBigSegmentStoreImpl) getMetadata(ctx context.Context) (subsystems.BigSegmentStoreMetadata, error) {
 	key := prefixedNamespace(store.prefix, bigSegmentsMetadataKey)
-	result, err := store.client.GetItem(store.context, &dynamodb.GetItemInput{
+	result, err := store.client.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName:      aws.String(store.table),
 		ConsistentRead: aws.Bool(true),
 		Key: map[string]types.AttributeValue{
 			tablePartitionKey: attrValueOfString(key),
 			tableSortKey:      attrValueOfString(key),
 		},
-	})
+	}, store.apiOptions...)
 	if err != nil {
 		return subsystems.BigSegmentStoreMetadata{}, err // COVERAGE: can't cause this in unit tests
 	}
@@ -89,14 +118,26 @@ func (store *dynamoDBBigSegmentStoreImpl) GetMetadata() (subsystems.BigSegmentSt
 func (store *dynamoDBBigSegmentStoreImpl) GetMembership(
 	contextHashKey string,
 ) (subsystems.BigSegmentMembership, error) {
-	result, err := store.client.GetItem(store.context, &dynamodb.GetItemInput{
+	ctx, span := store.tracer.start(store.context, "GetMembership", "")
+	span.setKeyCount(1)
+	membership, err := store.getMembership(ctx, contextHashKey)
+	err = classifyError(store.context, err)
+	span.end(err)
+	return membership, err
+}
+
+func (store *dynamoDBBigSegmentStoreImpl) getMembership(
+	ctx context.Context,
+	contextHashKey string,
+) (subsystems.BigSegmentMembership, error) {
+	result, err := store.client.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName:      aws.String(store.table),
 		ConsistentRead: aws.Bool(true),
 		Key: map[string]types.AttributeValue{
 			tablePartitionKey: attrValueOfString(prefixedNamespace(store.prefix, bigSegmentsUserDataKey)),
 			tableSortKey:      attrValueOfString(contextHashKey),
 		},
-	})
+	}, store.apiOptions...)
 	if err != nil {
 		return nil, err // COVERAGE: can't cause this in unit tests
 	}
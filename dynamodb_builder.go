@@ -1,6 +1,8 @@
 package lddynamodb
 
 import (
+	"time"
+
 	"github.com/launchdarkly/go-sdk-common/v3/ldvalue"
 	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
 
@@ -41,11 +43,40 @@ type StoreBuilder[T any] struct {
 
 type builderOptions struct {
 	client        *dynamodb.Client
+	sharedClient  *SharedClient
 	table         string
+	kindTables    map[string]string
 	prefix        string
 	awsConfig     *aws.Config
 	clientOptions *dynamodb.Options
 	clientOptFns  []func(*dynamodb.Options)
+	codec         ItemCodec
+	decodeCodecs  []ItemCodec
+
+	readCapacityLimit  float64
+	readCapacityBurst  float64
+	writeCapacityLimit float64
+	writeCapacityBurst float64
+
+	initConcurrency         int
+	initProgressHandler     func(InitProgress)
+	initProgressLogInterval time.Duration
+	requireCompleteInit     bool
+	writerID                string
+	writerLeaseDuration     time.Duration
+	skipUnchangedInit       bool
+	environmentID           string
+	allowEnvironmentChange  bool
+	versionRegressionPolicy VersionRegressionPolicy
+	readOnly                bool
+	readOnlyErrors          bool
+	fallbackSnapshotFile    string
+	packedSnapshot          bool
+	tracer                  Tracer
+	metrics                 Metrics
+	capacityAccounting      bool
+	capacityLogInterval     time.Duration
+	slowOperationThreshold  time.Duration
 }
 
 // DataStore returns a configurable builder for a DynamoDB-backed data store.
@@ -75,7 +106,9 @@ type builderOptions struct {
 func DataStore(tableName string) *StoreBuilder[subsystems.PersistentDataStore] {
 	return &StoreBuilder[subsystems.PersistentDataStore]{
 		builderOptions: builderOptions{
-			table: tableName,
+			table:                   tableName,
+			initConcurrency:         1,
+			initProgressLogInterval: DefaultInitProgressLogInterval,
 		},
 		factory: createPersistentDataStore,
 	}
@@ -117,6 +150,29 @@ func (b *StoreBuilder[T]) Prefix(prefix string) *StoreBuilder[T] {
 	return b
 }
 
+// KindTables specifies separate tables for some kinds of data, so that they can be given their own
+// capacity settings, backup policies, or access permissions. The keys of the map are the names of
+// data kinds, as returned by [github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes.DataKind.GetName]
+// (for instance, "features" or "segments"), and the values are table names. Every table must
+// already exist and must have the same key schema as the primary table.
+//
+// Any kind of data that is not in the map is stored in the primary table that was specified when
+// the builder was created. The primary table also holds the marker that indicates the store has
+// been initialized.
+//
+// In this example, flags are stored in the table "flags" and segments in the table "segments":
+//
+//	lddynamodb.DataStore("flags").KindTables(map[string]string{"segments": "segments"})
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) KindTables(tables map[string]string) *StoreBuilder[T] {
+	b.kindTables = make(map[string]string, len(tables))
+	for kindName, table := range tables {
+		b.kindTables[kindName] = table
+	}
+	return b
+}
+
 // DynamoClient specifies an existing DynamoDB client instance. Use this if you want to customize the client
 // used by the data store in ways that are not supported by other DataStoreBuilder options. If you
 // specify this option, then any configurations specified with SessionOptions or ClientConfig will be ignored.
@@ -125,6 +181,15 @@ func (b *StoreBuilder[T]) DynamoClient(client *dynamodb.Client) *StoreBuilder[T]
 	return b
 }
 
+// SharedClient specifies a [SharedClient] that this store should use, along with any other stores
+// that were configured with the same SharedClient. If you specify this option, then any
+// configurations specified with ClientConfig or ClientOptions will be ignored. If you also specify
+// DynamoClient, that takes precedence over SharedClient.
+func (b *StoreBuilder[T]) SharedClient(sharedClient *SharedClient) *StoreBuilder[T] {
+	b.sharedClient = sharedClient
+	return b
+}
+
 // ClientOptions specifies custom parameters for the dynamodb.NewFromConfig client constructor. This can be used
 // to set properties such as the region programmatically, rather than relying on the defaults from the environment.
 func (b *StoreBuilder[T]) ClientConfig(options aws.Config, optFns ...func(*dynamodb.Options)) *StoreBuilder[T] {
@@ -142,6 +207,352 @@ func (b *StoreBuilder[T]) ClientOptions(options dynamodb.Options, optFns ...func
 	return b
 }
 
+// Codec specifies how the content of each data item is stored in DynamoDB. The default is
+// [DefaultItemCodec], which stores the item's JSON in a string attribute.
+//
+// Items are always written with the specified codec. They can be read if they were written with
+// that codec, with the default codec, or with any of the codecs in decodeAlso. To move an existing
+// table from one non-default codec to another without downtime, specify the new codec first and
+// the old one in decodeAlso; items are rewritten with the new codec as they are updated, or all at
+// once by the next full initialization.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) Codec(codec ItemCodec, decodeAlso ...ItemCodec) *StoreBuilder[T] {
+	b.codec = codec
+	b.decodeCodecs = decodeAlso
+	return b
+}
+
+// Tracer enables tracing of the store's operations, using the specified implementation of [Tracer].
+// Use the ldotel subpackage to create spans with OpenTelemetry.
+//
+// Each call that the SDK makes to the store, such as Init, Get, GetAll, and Upsert for a data store,
+// or GetMetadata and GetMembership for a Big Segment store, runs in a span. Spans are given the table
+// name, prefix, data kind, and number of keys, the total DynamoDB capacity units consumed by the
+// operation, the number of conditional-check failures, and the outcome: "success", "not_updated",
+// "conditional_check_failed", or "error". To report consumed capacity, the store asks DynamoDB for it
+// in each request.
+//
+// Since the SDK does not pass a context to the store, the spans are not children of any span that
+// the application has started. If tracer is nil, which is the default, tracing is disabled.
+func (b *StoreBuilder[T]) Tracer(tracer Tracer) *StoreBuilder[T] {
+	b.tracer = tracer
+	return b
+}
+
+// Metrics enables reporting of measurements of the store's DynamoDB requests: their latency, errors
+// by type, conditional-check failures, items dropped because they were too large, and BatchWriteItem
+// retries and unprocessed items. Each measurement is labeled with the table name, prefix, and
+// DynamoDB operation.
+//
+// Use [ExpvarMetrics] to publish the measurements with the expvar package, or the ldprometheus
+// subpackage to register them with Prometheus. If metrics is nil, which is the default, nothing is
+// measured. This works for both data stores and Big Segment stores.
+func (b *StoreBuilder[T]) Metrics(metrics Metrics) *StoreBuilder[T] {
+	b.metrics = metrics
+	return b
+}
+
+// CapacityAccounting makes the store ask DynamoDB for the capacity units consumed by each request, and
+// add them up by DynamoDB operation and data kind, so that the application can attribute the cost of
+// the table to the services that use it.
+//
+// An application can get the totals by casting the built store to [CapacityStatsProvider]. If
+// logInterval is greater than zero, the store also logs them at Info level at that interval. The
+// totals do not include requests that fail, such as a write that is rejected because the store
+// already has a newer version of the item, because DynamoDB does not report their consumed capacity.
+// By default, consumed capacity is not requested or counted. This works for both data stores and Big
+// Segment stores.
+func (b *StoreBuilder[T]) CapacityAccounting(logInterval time.Duration) *StoreBuilder[T] {
+	b.capacityAccounting = true
+	b.capacityLogInterval = logInterval
+	return b
+}
+
+// SlowOperationThreshold makes the store log a warning for each GetItem, Query, PutItem, or
+// BatchWriteItem request to DynamoDB that takes longer than the specified duration, so that slow
+// requests can be told apart from other causes of flag evaluation latency.
+//
+// The message includes the operation, the table, the namespace and key of the item or the number of
+// items in the batch, the number of attempts made by the AWS SDK's retryer, and the total duration.
+// If threshold is zero or less, which is the default, slow requests are not logged. This works for
+// both data stores and Big Segment stores.
+func (b *StoreBuilder[T]) SlowOperationThreshold(threshold time.Duration) *StoreBuilder[T] {
+	b.slowOperationThreshold = threshold
+	return b
+}
+
+// ReadCapacityLimit limits the rate at which the data store consumes DynamoDB read capacity units, so
+// that it does not use up capacity that other users of the table need. The store estimates the cost
+// of each read from the size of the items, the same way DynamoDB does.
+//
+// The limit is a token bucket that refills at unitsPerSecond and can hold at most burst units; if
+// burst is zero or less, it defaults to unitsPerSecond. If unitsPerSecond is zero or less, there is
+// no limit, which is the default.
+//
+// When the limit has been reached, a request to get one item or all items of a kind fails
+// immediately with an error, rather than adding to the latency of flag evaluations; reads that are
+// part of initializing the store wait for capacity instead.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) ReadCapacityLimit(unitsPerSecond, burst float64) *StoreBuilder[T] {
+	b.readCapacityLimit = unitsPerSecond
+	b.readCapacityBurst = burst
+	return b
+}
+
+// WriteCapacityLimit limits the rate at which the data store consumes DynamoDB write capacity units.
+// This is especially useful for initializing the store with a large data set, which otherwise writes
+// items as fast as DynamoDB will accept them.
+//
+// The limit works the same way as [StoreBuilder.ReadCapacityLimit], except that all writes wait for
+// capacity to become available rather than failing.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) WriteCapacityLimit(unitsPerSecond, burst float64) *StoreBuilder[T] {
+	b.writeCapacityLimit = unitsPerSecond
+	b.writeCapacityBurst = burst
+	return b
+}
+
+// InitConcurrency specifies how many DynamoDB requests the data store may run at once when it is
+// initialized with a full data set: that is, how many batches of items it writes in parallel, and how
+// many kinds of data it queries in parallel to find existing items. The default is 1, meaning that
+// requests are made one at a time.
+//
+// Raising this can make initialization of a large data set much faster. The marker that indicates
+// the store is initialized is still written only after every batch has been written successfully.
+// If you have also set [StoreBuilder.WriteCapacityLimit], parallel writes share that limit.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) InitConcurrency(concurrency int) *StoreBuilder[T] {
+	b.initConcurrency = concurrency
+	return b
+}
+
+// InitProgressHandler specifies a function to be called as the data store makes progress in
+// initializing itself with a full data set, which can take a long time for a large data set. The
+// function is called at the start of each [InitPhase] and whenever more work in that phase has been
+// completed. It is never called concurrently, but it is called synchronously during initialization,
+// so it should return quickly.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) InitProgressHandler(handler func(InitProgress)) *StoreBuilder[T] {
+	b.initProgressHandler = handler
+	return b
+}
+
+// InitProgressLogInterval specifies how often the data store logs its progress at INFO level while
+// it is initializing itself with a full data set. The default is [DefaultInitProgressLogInterval].
+// If the interval is zero or negative, progress is not logged.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) InitProgressLogInterval(interval time.Duration) *StoreBuilder[T] {
+	b.initProgressLogInterval = interval
+	return b
+}
+
+// RequireCompleteInit tells the data store not to report itself as initialized if the most recent
+// attempt to initialize it with a full data set did not finish.
+//
+// Before it starts writing a full data set, the data store records that an initialization is in
+// progress, and it records that the initialization is complete when it has finished. If the process
+// stops in between, the table may contain a mixture of old and new data. The store always logs a
+// warning when it detects this, either when the SDK asks whether it has been initialized or before
+// the next initialization. With this option, it also reports that it is not initialized until
+// another full initialization has succeeded, so that the SDK does not treat the partial data as valid.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) RequireCompleteInit() *StoreBuilder[T] {
+	b.requireCompleteInit = true
+	return b
+}
+
+// SkipUnchangedInit tells the data store not to rewrite the table when it is asked to initialize
+// itself with the same data set that it already contains, which often happens when the SDK
+// reconnects to LaunchDarkly.
+//
+// With this option, the store computes a hash of the table, namespace, key, and version of every
+// item in the data set, and records it along with the marker that indicates the store has been
+// initialized. A later initialization whose data set has the same hash does nothing, as long as the
+// previous one completed. If there is no recorded hash, for instance because the table was last
+// initialized by a store without this option, or if the hash is different, the store writes the full
+// data set as usual.
+//
+// Since the hash only covers versions, not content, this relies on LaunchDarkly always changing an
+// item's version when its content changes, which it does.
+//
+// Because an update makes the table differ from the data set it was initialized with, the store
+// removes the recorded hash before it writes each update, which costs one more write capacity unit
+// per update. For this to work, every store that writes to the same table and prefix should have this
+// option.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) SkipUnchangedInit() *StoreBuilder[T] {
+	b.skipUnchangedInit = true
+	return b
+}
+
+// ReadOnly makes the data store never write to DynamoDB, for applications that only read data that
+// some other process, such as the Relay Proxy, has stored; for instance, an application that uses
+// daemon mode with AWS credentials that only allow reading the table.
+//
+// If the SDK nevertheless asks the store to initialize itself or to update an item, the store does
+// nothing and logs a message, rather than trying the write and getting an access error from DynamoDB.
+// To make those calls return an error instead, use [StoreBuilder.ReadOnlyWithErrors]. A read-only
+// store also ignores [StoreBuilder.WriterLease], and its availability check only reads from the
+// table.
+//
+// This option has no effect on a Big Segment store, which never writes.
+func (b *StoreBuilder[T]) ReadOnly() *StoreBuilder[T] {
+	b.readOnly = true
+	return b
+}
+
+// ReadOnlyWithErrors is like [StoreBuilder.ReadOnly], except that when the SDK asks the store to
+// initialize itself or to update an item, it returns an error instead of doing nothing.
+//
+// This option has no effect on a Big Segment store, which never writes.
+func (b *StoreBuilder[T]) ReadOnlyWithErrors() *StoreBuilder[T] {
+	b.readOnly = true
+	b.readOnlyErrors = true
+	return b
+}
+
+// PackedSnapshot makes the data store write a compressed copy of the whole data set to DynamoDB
+// whenever it is initialized, so that reading all flags or all segments, as the SDK does when it
+// starts, takes a few requests instead of a query that pages through every item. This is useful when
+// there are thousands of items and many application instances start at once.
+//
+// The snapshot is stored in a few items under the store's prefix, in the primary table. When an item
+// is updated, the store marks the snapshot as stale, which costs one more write per update, and
+// readers go back to reading individual items until the next initialization writes a new snapshot.
+// Stores that read the table should also have this option, since without it they do not use the
+// snapshot; stores that write to the table must have it, or their updates will not mark the snapshot
+// as stale.
+//
+// The snapshot contains the serialized items without passing them through the store's [ItemCodec],
+// so this option cannot be combined with a non-default codec, such as one that encrypts or signs
+// items; building a data store with both returns an error.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) PackedSnapshot() *StoreBuilder[T] {
+	b.packedSnapshot = true
+	return b
+}
+
+// FallbackSnapshotFile specifies a local file in which the data store keeps a copy of the data that
+// it reads from DynamoDB, so that it can still provide flags and segments if DynamoDB cannot be
+// reached; for instance, if an application that uses daemon mode starts during a DynamoDB outage.
+//
+// Whenever the store successfully reads all items of a kind and they are different from the ones in
+// the file, it rewrites the file in the background, at most once a second, and once more when the
+// store is closed. It does this by writing a temporary file in the same directory and renaming it, so
+// the file is never left partly written. If a read fails because DynamoDB cannot be reached, times out,
+// is throttling requests, or returns a server error, the store returns the items from the file
+// instead, which may be out of date, and logs a warning; other errors, such as a missing table or
+// denied access, are returned as usual. While that is happening, the store reports itself as
+// unavailable, as it would without this option, so that the SDK knows the data is stale; when
+// DynamoDB can be reached again, the store goes back to reading from it, and logs a message. The file
+// is never used for writes, so any updates that the SDK tries to make during the outage fail as usual.
+//
+// If the file exists when the store is created, its contents can be used right away. If it does not
+// exist, or cannot be read, the store behaves as it would without this option until it has read from
+// DynamoDB successfully.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) FallbackSnapshotFile(path string) *StoreBuilder[T] {
+	b.fallbackSnapshotFile = path
+	return b
+}
+
+// VersionRegressionPolicy specifies what the data store should do when it is asked to initialize
+// itself with a data set that contains an older version of an item than the one already in the table,
+// as can happen if an application instance that is lagging behind, or that was started from an old
+// bootstrap file, initializes the store.
+//
+// The store compares each item in the data set with the version that it finds in the table when it
+// starts initializing. With [VersionRegressionSkip], it keeps the stored item; with
+// [VersionRegressionRefuse], it does not write anything and returns an error. Either way, it logs a
+// warning for each such item. The default is [VersionRegressionAllow], which replaces the stored
+// items regardless of their versions.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) VersionRegressionPolicy(policy VersionRegressionPolicy) *StoreBuilder[T] {
+	b.versionRegressionPolicy = policy
+	return b
+}
+
+// EnvironmentID specifies an identifier for the LaunchDarkly environment whose data this store holds,
+// such as the environment's key.
+//
+// When this option is set, the data store records a fingerprint of the environment ID when it is
+// initialized, and it refuses to initialize the table or update items in it if the table was
+// initialized with a different fingerprint. This keeps two environments that have been mistakenly
+// configured with the same table and prefix from overwriting each other's data. Tables that were
+// initialized without a fingerprint can be written by any store. If this option is not set, which is
+// the default, the store does not check the environment. See also [StoreBuilder.AllowEnvironmentChange].
+//
+// To avoid reading the fingerprint for every update, the store remembers the one it last saw for up
+// to 10 seconds; so if another environment initializes the table, this store may still update items
+// during that time, and is refused after that.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) EnvironmentID(id string) *StoreBuilder[T] {
+	b.environmentID = id
+	return b
+}
+
+// AllowEnvironmentChange lets the data store write to a table that was initialized by a different
+// LaunchDarkly environment (see [StoreBuilder.EnvironmentID]), replacing that environment's data.
+// This is useful when a table is deliberately being reused for another environment. The store logs a
+// warning when it does this.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) AllowEnvironmentChange() *StoreBuilder[T] {
+	b.allowEnvironmentChange = true
+	return b
+}
+
+// WriterLease makes data stores that share the same table and prefix elect a single writer among
+// themselves, so that when many instances of an application are connected to LaunchDarkly at once,
+// only one of them writes the data it receives to DynamoDB.
+//
+// Each store that has this option tries to claim a lease item in the table, using a conditional write
+// so that only one store can hold it at a time, and the holder renews it in the background at one
+// third of the specified duration. Only the holder writes data; the other stores act as readers, so
+// their Init calls do nothing and their Upsert calls report that the item was not updated, which tells
+// the SDK to read the current item from the store. If the holder stops renewing the lease, for
+// instance because it shut down, another store claims it once it expires. Since updates that were
+// received while no store held the lease were not written, the new holder returns an error from its
+// next Upsert, which makes the SDK treat the store as having had an outage and initialize it again
+// with a full data set; after that, it writes updates as usual. If a store loses the lease while its
+// Init is running, Init stops and returns an error, rather than overwriting the new holder's data.
+// When a store that holds the lease is closed, it gives up the lease immediately. Claiming and
+// renewing the lease count against [StoreBuilder.WriteCapacityLimit], but never wait for it, so that
+// a rate-limited Init cannot delay a renewal until the lease expires.
+//
+// Because lease expiry is based on each host's clock, the duration should be much longer than any
+// clock skew between hosts; 30 seconds or more is reasonable. If the duration is zero or less, the
+// lease is not used, which is the default.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) WriterLease(duration time.Duration) *StoreBuilder[T] {
+	b.writerLeaseDuration = duration
+	return b
+}
+
+// WriterID specifies an identifier for this data store instance, which is recorded in DynamoDB when
+// the store claims the writer lease (see [StoreBuilder.WriterLease]) and when it is initialized (see
+// [InitInfo]). It should be unique among all instances that share the same table and prefix. The
+// default is the host name followed by a random suffix.
+//
+// This option has no effect on a Big Segment store.
+func (b *StoreBuilder[T]) WriterID(id string) *StoreBuilder[T] {
+	b.writerID = id
+	return b
+}
+
 // Build is called internally by the SDK.
 func (b *StoreBuilder[T]) Build(context subsystems.ClientContext) (T, error) {
 	return b.factory(b, context)
@@ -156,7 +567,8 @@ func createPersistentDataStore(
 	builder *StoreBuilder[subsystems.PersistentDataStore],
 	clientContext subsystems.ClientContext,
 ) (subsystems.PersistentDataStore, error) {
-	return newDynamoDBDataStoreImpl(builder.builderOptions, clientContext.GetLogging().Loggers)
+	environment := environmentFingerprint(builder.environmentID)
+	return newDynamoDBDataStoreImpl(builder.builderOptions, environment, clientContext.GetLogging().Loggers)
 }
 
 func createBigSegmentStore(
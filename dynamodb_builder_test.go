@@ -3,6 +3,7 @@ package lddynamodb
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/launchdarkly/go-sdk-common/v3/ldvalue"
 	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
@@ -10,6 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDataSourceBuilder(t *testing.T) {
@@ -21,6 +23,28 @@ func TestDataSourceBuilder(t *testing.T) {
 		assert.Nil(t, b.clientOptions)
 		assert.Len(t, b.clientOptFns, 0)
 		assert.Equal(t, "t", b.table)
+		assert.Nil(t, b.codec)
+		assert.Len(t, b.kindTables, 0)
+		assert.Nil(t, b.sharedClient)
+		assert.Equal(t, 1, b.initConcurrency)
+		assert.Nil(t, b.initProgressHandler)
+		assert.Equal(t, DefaultInitProgressLogInterval, b.initProgressLogInterval)
+		assert.False(t, b.requireCompleteInit)
+		assert.Equal(t, time.Duration(0), b.writerLeaseDuration)
+		assert.False(t, b.skipUnchangedInit)
+		assert.Equal(t, "", b.environmentID)
+		assert.False(t, b.allowEnvironmentChange)
+		assert.Equal(t, VersionRegressionAllow, b.versionRegressionPolicy)
+		assert.False(t, b.readOnly)
+		assert.False(t, b.readOnlyErrors)
+		assert.Equal(t, "", b.fallbackSnapshotFile)
+		assert.False(t, b.packedSnapshot)
+		assert.Nil(t, b.tracer)
+		assert.Nil(t, b.metrics)
+		assert.False(t, b.capacityAccounting)
+		assert.Equal(t, time.Duration(0), b.capacityLogInterval)
+		assert.Equal(t, time.Duration(0), b.slowOperationThreshold)
+		assert.Equal(t, "", b.writerID)
 	})
 
 	t.Run("ClientConfig", func(t *testing.T) {
@@ -52,6 +76,138 @@ func TestDataSourceBuilder(t *testing.T) {
 		assert.Equal(t, client, b.client)
 	})
 
+	t.Run("Codec", func(t *testing.T) {
+		codec := ChainedItemCodec(GzipItemTransform())
+		b := DataStore("t").Codec(codec, DefaultItemCodec())
+		assert.Equal(t, codec, b.codec)
+		assert.Equal(t, []ItemCodec{DefaultItemCodec()}, b.decodeCodecs)
+	})
+
+	t.Run("KindTables", func(t *testing.T) {
+		tables := map[string]string{"segments": "t2"}
+		b := DataStore("t").KindTables(tables)
+		assert.Equal(t, map[string]string{"segments": "t2"}, b.kindTables)
+
+		tables["features"] = "t3" // the builder keeps its own copy
+		assert.Equal(t, map[string]string{"segments": "t2"}, b.kindTables)
+	})
+
+	t.Run("SharedClient", func(t *testing.T) {
+		shared := NewSharedClient()
+		b := DataStore("t").SharedClient(shared)
+		assert.Same(t, shared, b.sharedClient)
+	})
+
+	t.Run("ReadCapacityLimit", func(t *testing.T) {
+		b := DataStore("t").ReadCapacityLimit(5, 10)
+		assert.Equal(t, 5.0, b.readCapacityLimit)
+		assert.Equal(t, 10.0, b.readCapacityBurst)
+	})
+
+	t.Run("WriteCapacityLimit", func(t *testing.T) {
+		b := DataStore("t").WriteCapacityLimit(5, 10)
+		assert.Equal(t, 5.0, b.writeCapacityLimit)
+		assert.Equal(t, 10.0, b.writeCapacityBurst)
+	})
+
+	t.Run("InitConcurrency", func(t *testing.T) {
+		b := DataStore("t").InitConcurrency(8)
+		assert.Equal(t, 8, b.initConcurrency)
+	})
+
+	t.Run("InitProgressHandler", func(t *testing.T) {
+		called := false
+		b := DataStore("t").InitProgressHandler(func(InitProgress) { called = true })
+		require.NotNil(t, b.initProgressHandler)
+		b.initProgressHandler(InitProgress{})
+		assert.True(t, called)
+	})
+
+	t.Run("InitProgressLogInterval", func(t *testing.T) {
+		b := DataStore("t").InitProgressLogInterval(time.Minute)
+		assert.Equal(t, time.Minute, b.initProgressLogInterval)
+	})
+
+	t.Run("RequireCompleteInit", func(t *testing.T) {
+		b := DataStore("t").RequireCompleteInit()
+		assert.True(t, b.requireCompleteInit)
+	})
+
+	t.Run("SkipUnchangedInit", func(t *testing.T) {
+		b := DataStore("t").SkipUnchangedInit()
+		assert.True(t, b.skipUnchangedInit)
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		b := DataStore("t").ReadOnly()
+		assert.True(t, b.readOnly)
+		assert.False(t, b.readOnlyErrors)
+	})
+
+	t.Run("ReadOnlyWithErrors", func(t *testing.T) {
+		b := DataStore("t").ReadOnlyWithErrors()
+		assert.True(t, b.readOnly)
+		assert.True(t, b.readOnlyErrors)
+	})
+
+	t.Run("Tracer", func(t *testing.T) {
+		tracer := &recordedTracer{}
+		b := DataStore("t").Tracer(tracer)
+		assert.Equal(t, tracer, b.tracer)
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		metrics := newRecordedMetrics()
+		b := DataStore("t").Metrics(metrics)
+		assert.Equal(t, metrics, b.metrics)
+	})
+
+	t.Run("CapacityAccounting", func(t *testing.T) {
+		b := DataStore("t").CapacityAccounting(time.Minute)
+		assert.True(t, b.capacityAccounting)
+		assert.Equal(t, time.Minute, b.capacityLogInterval)
+	})
+
+	t.Run("SlowOperationThreshold", func(t *testing.T) {
+		b := DataStore("t").SlowOperationThreshold(time.Second)
+		assert.Equal(t, time.Second, b.slowOperationThreshold)
+	})
+
+	t.Run("PackedSnapshot", func(t *testing.T) {
+		b := DataStore("t").PackedSnapshot()
+		assert.True(t, b.packedSnapshot)
+	})
+
+	t.Run("FallbackSnapshotFile", func(t *testing.T) {
+		b := DataStore("t").FallbackSnapshotFile("/tmp/snapshot.json")
+		assert.Equal(t, "/tmp/snapshot.json", b.fallbackSnapshotFile)
+	})
+
+	t.Run("VersionRegressionPolicy", func(t *testing.T) {
+		b := DataStore("t").VersionRegressionPolicy(VersionRegressionRefuse)
+		assert.Equal(t, VersionRegressionRefuse, b.versionRegressionPolicy)
+	})
+
+	t.Run("EnvironmentID", func(t *testing.T) {
+		b := DataStore("t").EnvironmentID("env1")
+		assert.Equal(t, "env1", b.environmentID)
+	})
+
+	t.Run("AllowEnvironmentChange", func(t *testing.T) {
+		b := DataStore("t").AllowEnvironmentChange()
+		assert.True(t, b.allowEnvironmentChange)
+	})
+
+	t.Run("WriterLease", func(t *testing.T) {
+		b := DataStore("t").WriterLease(time.Minute)
+		assert.Equal(t, time.Minute, b.writerLeaseDuration)
+	})
+
+	t.Run("WriterID", func(t *testing.T) {
+		b := DataStore("t").WriterID("pod-1")
+		assert.Equal(t, "pod-1", b.writerID)
+	})
+
 	t.Run("Prefix", func(t *testing.T) {
 		b := DataStore("t").Prefix("p")
 		assert.Equal(t, "p", b.prefix)
@@ -0,0 +1,221 @@
+package lddynamodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// CapacityKey identifies what consumed capacity units are counted for in [CapacityStats].
+type CapacityKey struct {
+	// Operation is the name of the DynamoDB API operation, such as "GetItem" or "BatchWriteItem".
+	Operation string
+	// Kind is the namespace of the items without the store's prefix: a data kind such as "features"
+	// or "segments", a Big Segment namespace, or one of the store's own namespaces such as "$inited".
+	Kind string
+}
+
+// CapacityStats is a snapshot of the DynamoDB capacity units consumed by a store. See
+// [StoreBuilder.CapacityAccounting].
+type CapacityStats struct {
+	// Since is when the store started counting.
+	Since time.Time
+	// ReadUnits is the total number of read capacity units consumed.
+	ReadUnits float64
+	// WriteUnits is the total number of write capacity units consumed.
+	WriteUnits float64
+	// Units is the number of capacity units consumed for each operation and kind.
+	Units map[CapacityKey]float64
+}
+
+// CapacityStatsProvider is implemented by the data store and the Big Segment store that are created
+// by [DataStore] and [BigSegmentStore], for applications that want to report how much capacity each
+// store consumes.
+type CapacityStatsProvider interface {
+	// CapacityStats returns the capacity units that the store has consumed. If
+	// [StoreBuilder.CapacityAccounting] was not used, it returns a zero CapacityStats.
+	CapacityStats() CapacityStats
+}
+
+// capacityAccountant adds up the capacity units that DynamoDB reports for a store's requests. All of
+// its methods can be called on a nil *capacityAccountant, meaning that accounting is disabled.
+type capacityAccountant struct {
+	prefix string
+	lock   sync.Mutex
+	stats  CapacityStats
+}
+
+func newCapacityAccountant(enabled bool, prefix string) *capacityAccountant {
+	if !enabled {
+		return nil
+	}
+	return &capacityAccountant{
+		prefix: prefix,
+		stats:  CapacityStats{Since: time.Now(), Units: make(map[CapacityKey]float64)},
+	}
+}
+
+func (a *capacityAccountant) snapshot() CapacityStats {
+	if a == nil {
+		return CapacityStats{}
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	ret := a.stats
+	ret.Units = make(map[CapacityKey]float64, len(a.stats.Units))
+	for key, units := range a.stats.Units {
+		ret.Units[key] = units
+	}
+	return ret
+}
+
+// logPeriodically logs a summary of the stats at the specified interval until the context is done.
+func (a *capacityAccountant) logPeriodically(ctx context.Context, interval time.Duration, loggers ldlog.Loggers) {
+	if a == nil || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			loggers.Info(a.snapshot().summary())
+		}
+	}
+}
+
+func (s CapacityStats) summary() string {
+	keys := make([]CapacityKey, 0, len(s.Units))
+	for key := range s.Units {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Operation != keys[j].Operation {
+			return keys[i].Operation < keys[j].Operation
+		}
+		return keys[i].Kind < keys[j].Kind
+	})
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s/%s=%.1f", key.Operation, key.Kind, s.Units[key]))
+	}
+	return fmt.Sprintf("Consumed capacity units since %s: read=%.1f write=%.1f [%s]",
+		s.Since.Format(time.RFC3339), s.ReadUnits, s.WriteUnits, strings.Join(parts, ", "))
+}
+
+// addMiddleware is passed to each DynamoDB client call when accounting is enabled.
+func (a *capacityAccountant) addMiddleware(options *dynamodb.Options) {
+	options.APIOptions = append(options.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("LaunchDarklyCapacity", a.handleInitialize),
+			middleware.After)
+	})
+}
+
+func (a *capacityAccountant) handleInitialize(
+	ctx context.Context,
+	in middleware.InitializeInput,
+	next middleware.InitializeHandler,
+) (middleware.InitializeOutput, middleware.Metadata, error) {
+	requestConsumedCapacity(in.Parameters)
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	// DynamoDB does not report the capacity consumed by a request that fails
+	if units := consumedCapacityOf(out.Result); units > 0 {
+		a.record(awsmiddleware.GetOperationName(ctx), a.namespaceWeights(in.Parameters), units)
+	}
+	return out, metadata, err
+}
+
+// record divides the capacity units that a request consumed among the kinds of items it accessed,
+// in proportion to their weights.
+func (a *capacityAccountant) record(operation string, weights map[string]float64, units float64) {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	switch operation {
+	case "GetItem", "Query":
+		a.stats.ReadUnits += units
+	default:
+		a.stats.WriteUnits += units
+	}
+	if total == 0 {
+		a.stats.Units[CapacityKey{Operation: operation}] += units // COVERAGE: we don't make requests like this
+		return
+	}
+	for kind, weight := range weights {
+		a.stats.Units[CapacityKey{Operation: operation, Kind: kind}] += units * weight / total
+	}
+}
+
+// namespaceWeights returns the kinds of items that a request accesses, weighted by how much of its
+// capacity they are likely to consume. Only requests that write several items can have more than one.
+func (a *capacityAccountant) namespaceWeights(params interface{}) map[string]float64 {
+	weights := make(map[string]float64)
+	add := func(key map[string]types.AttributeValue, weight float64) {
+		kind := attrValueToString(key[tablePartitionKey])
+		if a.prefix != "" {
+			kind = strings.TrimPrefix(kind, a.prefix+":")
+		}
+		weights[kind] += weight
+	}
+	switch input := params.(type) {
+	case *dynamodb.GetItemInput:
+		add(input.Key, 1)
+	case *dynamodb.QueryInput:
+		if cond, ok := input.KeyConditions[tablePartitionKey]; ok && len(cond.AttributeValueList) > 0 {
+			add(map[string]types.AttributeValue{tablePartitionKey: cond.AttributeValueList[0]}, 1)
+		}
+	case *dynamodb.PutItemInput:
+		add(input.Item, 1)
+	case *dynamodb.UpdateItemInput:
+		add(input.Key, 1)
+	case *dynamodb.DeleteItemInput:
+		add(input.Key, 1)
+	case *dynamodb.BatchWriteItemInput:
+		for _, requests := range input.RequestItems {
+			for _, r := range requests {
+				if r.PutRequest != nil {
+					add(r.PutRequest.Item, writeCapacityUnits(itemSize(r.PutRequest.Item)))
+				} else if r.DeleteRequest != nil {
+					add(r.DeleteRequest.Key, 1)
+				}
+			}
+		}
+	case *dynamodb.TransactWriteItemsInput:
+		for _, item := range input.TransactItems {
+			switch {
+			case item.Put != nil:
+				add(item.Put.Item, writeCapacityUnits(itemSize(item.Put.Item)))
+			case item.Update != nil:
+				add(item.Update.Key, 1)
+			case item.Delete != nil:
+				add(item.Delete.Key, 1)
+			case item.ConditionCheck != nil:
+				add(item.ConditionCheck.Key, 1)
+			}
+		}
+	}
+	return weights
+}
+
+func (store *dynamoDBDataStore) CapacityStats() CapacityStats {
+	return store.capacity.snapshot()
+}
+
+func (store *dynamoDBBigSegmentStoreImpl) CapacityStats() CapacityStats {
+	return store.capacity.snapshot()
+}
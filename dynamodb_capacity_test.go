@@ -0,0 +1,114 @@
+package lddynamodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+	"github.com/launchdarkly/go-sdk-common/v3/ldlogtest"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreCapacityAccounting(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	flag := func(version int) ldstoretypes.SerializedItemDescriptor {
+		return ldstoretypes.SerializedItemDescriptor{Version: version, SerializedItem: []byte(`{}`)}
+	}
+
+	t.Run("data store", func(t *testing.T) {
+		require.NoError(t, clearTestData("counted"))
+		store, err := baseDataStoreBuilder().Prefix("counted").CapacityAccounting(0).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+		provider := store.(CapacityStatsProvider)
+
+		before := time.Now()
+		require.NoError(t, store.Init([]ldstoretypes.SerializedCollection{
+			{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+				{Key: "flag1", Item: flag(1)}, {Key: "flag2", Item: flag(1)},
+			}},
+			{Kind: ldstoreimpl.Segments(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+				{Key: "segment1", Item: flag(1)},
+			}},
+		}))
+		_, err = store.Get(ldstoreimpl.Features(), "flag1")
+		require.NoError(t, err)
+		_, err = store.GetAll(ldstoreimpl.Segments())
+		require.NoError(t, err)
+		_, err = store.Upsert(ldstoreimpl.Features(), "flag1", flag(2))
+		require.NoError(t, err)
+
+		stats := provider.CapacityStats()
+		assert.False(t, stats.Since.After(before))
+		batchFeatures := stats.Units[CapacityKey{Operation: "BatchWriteItem", Kind: "features"}]
+		batchSegments := stats.Units[CapacityKey{Operation: "BatchWriteItem", Kind: "segments"}]
+		assert.Greater(t, batchFeatures, 0.0)
+		assert.Greater(t, batchSegments, 0.0)
+		assert.InDelta(t, 2*batchSegments, batchFeatures, 0.001) // divided by number of items
+		assert.Greater(t, stats.Units[CapacityKey{Operation: "GetItem", Kind: "features"}], 0.0)
+		assert.Greater(t, stats.Units[CapacityKey{Operation: "Query", Kind: "segments"}], 0.0)
+		assert.Greater(t, stats.Units[CapacityKey{Operation: "PutItem", Kind: "features"}], 0.0)
+		assert.Greater(t, stats.Units[CapacityKey{Operation: "Query", Kind: "$inited"}], 0.0)
+
+		read, write := 0.0, 0.0
+		for key, units := range stats.Units {
+			if key.Operation == "GetItem" || key.Operation == "Query" {
+				read += units
+			} else {
+				write += units
+			}
+		}
+		assert.InDelta(t, read, stats.ReadUnits, 0.001)
+		assert.InDelta(t, write, stats.WriteUnits, 0.001)
+
+		// The snapshot is a copy
+		stats.Units[CapacityKey{Operation: "GetItem", Kind: "features"}] = 1000
+		assert.Less(t, provider.CapacityStats().Units[CapacityKey{Operation: "GetItem", Kind: "features"}], 1000.0)
+	})
+
+	t.Run("Big Segment store", func(t *testing.T) {
+		store, err := BigSegmentStore(testTableName).ClientOptions(makeTestOptions()).CapacityAccounting(0).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+
+		_, err = store.GetMembership("abc")
+		require.NoError(t, err)
+		stats := store.(CapacityStatsProvider).CapacityStats()
+		assert.Greater(t, stats.Units[CapacityKey{Operation: "GetItem", Kind: bigSegmentsUserDataKey}], 0.0)
+		assert.Equal(t, 0.0, stats.WriteUnits)
+	})
+
+	t.Run("summary is logged periodically", func(t *testing.T) {
+		mockLog := ldlogtest.NewMockLog()
+		ctx := subsystems.BasicClientContext{}
+		ctx.Logging.Loggers = mockLog.Loggers
+		store, err := baseDataStoreBuilder().CapacityAccounting(10 * time.Millisecond).Build(ctx)
+		require.NoError(t, err)
+		defer store.Close()
+
+		_, err = store.Get(ldstoreimpl.Features(), "flag1")
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return mockLog.HasMessageMatch(ldlog.Info,
+				`Consumed capacity units since .*: read=[0-9.]+ write=0\.0 \[GetItem/features=`)
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("accounting is disabled by default", func(t *testing.T) {
+		store, err := baseDataStoreBuilder().Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+
+		_, err = store.Get(ldstoreimpl.Features(), "flag1")
+		require.NoError(t, err)
+		assert.Equal(t, CapacityStats{}, store.(CapacityStatsProvider).CapacityStats())
+	})
+}
@@ -0,0 +1,236 @@
+package lddynamodb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// Name of the attribute that records which codec was used to encode an item. It is omitted for
+	// items written with the default codec, so that those are identical to what earlier versions of
+	// this library wrote.
+	codecAttribute = "codec"
+
+	defaultItemCodecName = "json"
+)
+
+// ItemCodec converts a data item to and from the DynamoDB attributes that are stored for it.
+//
+// The data store always manages the "namespace", "key", and "version" attributes itself, since it
+// needs them for queries and for conditional updates; a codec is responsible only for the remaining
+// attributes that hold the item's content. A codec must not use any of those attribute names, nor
+// the "codec" attribute which the data store uses to record which codec wrote each item.
+//
+// Use [DefaultItemCodec] for the standard format, or [ChainedItemCodec] to apply a series of
+// transformations such as compression, encryption, or signing.
+type ItemCodec interface {
+	// Name returns a unique identifier for the codec. It is stored along with every item the codec
+	// encodes, so that the item can still be decoded after the data store has been reconfigured to
+	// write with a different codec.
+	Name() string
+
+	// Encode returns the attributes that represent the item's content.
+	Encode(item ldstoretypes.SerializedItemDescriptor) (map[string]types.AttributeValue, error)
+
+	// Decode reconstructs the item's content from the attributes that were written by Encode. The
+	// Version field of the result is ignored, since the data store reads the version itself.
+	Decode(attrs map[string]types.AttributeValue) (ldstoretypes.SerializedItemDescriptor, error)
+}
+
+// ItemTransform is one step in a chain of byte-level transformations built with [ChainedItemCodec].
+type ItemTransform interface {
+	// Name returns a unique identifier for the transformation.
+	Name() string
+
+	// Apply transforms the data before it is stored.
+	Apply(data []byte) ([]byte, error)
+
+	// Reverse undoes the effect of Apply after the data has been read.
+	Reverse(data []byte) ([]byte, error)
+}
+
+type defaultItemCodec struct{}
+
+type chainedItemCodec struct {
+	name       string
+	transforms []ItemTransform
+}
+
+type gzipItemTransform struct{}
+
+// DefaultItemCodec returns the codec that the data store uses if no other codec is specified. It
+// stores the serialized JSON of the item as a string in a single attribute, "item".
+func DefaultItemCodec() ItemCodec {
+	return defaultItemCodec{}
+}
+
+// ChainedItemCodec returns a codec that passes the serialized item through each of the specified
+// transforms in order, and stores the result as binary data in the "item" attribute. When the
+// item is read, the transforms are reversed in the opposite order.
+//
+// For instance, to compress items and then encrypt them with an application-provided transform:
+//
+//	lddynamodb.DataStore("my-table").Codec(
+//		lddynamodb.ChainedItemCodec(lddynamodb.GzipItemTransform(), myEncryptionTransform),
+//	)
+//
+// The name of the resulting codec is the names of the transforms joined with "+". If no transforms
+// are specified, this returns [DefaultItemCodec].
+func ChainedItemCodec(transforms ...ItemTransform) ItemCodec {
+	if len(transforms) == 0 {
+		return DefaultItemCodec()
+	}
+	names := make([]string, 0, len(transforms))
+	for _, t := range transforms {
+		names = append(names, t.Name())
+	}
+	return chainedItemCodec{
+		name:       strings.Join(names, "+"),
+		transforms: append([]ItemTransform(nil), transforms...),
+	}
+}
+
+// GzipItemTransform returns an [ItemTransform] that compresses data with gzip.
+func GzipItemTransform() ItemTransform {
+	return gzipItemTransform{}
+}
+
+func (c defaultItemCodec) Name() string {
+	return defaultItemCodecName
+}
+
+func (c defaultItemCodec) Encode(
+	item ldstoretypes.SerializedItemDescriptor,
+) (map[string]types.AttributeValue, error) {
+	return map[string]types.AttributeValue{
+		itemJSONAttribute: attrValueOfString(string(item.SerializedItem)),
+	}, nil
+}
+
+func (c defaultItemCodec) Decode(
+	attrs map[string]types.AttributeValue,
+) (ldstoretypes.SerializedItemDescriptor, error) {
+	return ldstoretypes.SerializedItemDescriptor{
+		SerializedItem: []byte(attrValueToString(attrs[itemJSONAttribute])),
+	}, nil
+}
+
+func (c chainedItemCodec) Name() string {
+	return c.name
+}
+
+func (c chainedItemCodec) Encode(
+	item ldstoretypes.SerializedItemDescriptor,
+) (map[string]types.AttributeValue, error) {
+	data := item.SerializedItem
+	for _, t := range c.transforms {
+		var err error
+		if data, err = t.Apply(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Name(), err)
+		}
+	}
+	return map[string]types.AttributeValue{
+		itemJSONAttribute: &types.AttributeValueMemberB{Value: data},
+	}, nil
+}
+
+func (c chainedItemCodec) Decode(
+	attrs map[string]types.AttributeValue,
+) (ldstoretypes.SerializedItemDescriptor, error) {
+	b, ok := attrs[itemJSONAttribute].(*types.AttributeValueMemberB)
+	if !ok {
+		return ldstoretypes.SerializedItemDescriptor{}, fmt.Errorf("%q attribute is not binary data", itemJSONAttribute)
+	}
+	data := b.Value
+	for i := len(c.transforms) - 1; i >= 0; i-- {
+		var err error
+		if data, err = c.transforms[i].Reverse(data); err != nil {
+			return ldstoretypes.SerializedItemDescriptor{}, fmt.Errorf("%s: %w", c.transforms[i].Name(), err)
+		}
+	}
+	return ldstoretypes.SerializedItemDescriptor{SerializedItem: data}, nil
+}
+
+func (t gzipItemTransform) Name() string {
+	return "gzip"
+}
+
+func (t gzipItemTransform) Apply(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err // COVERAGE: writing to a bytes.Buffer can't fail
+	}
+	if err := w.Close(); err != nil {
+		return nil, err // COVERAGE: writing to a bytes.Buffer can't fail
+	}
+	return buf.Bytes(), nil
+}
+
+func (t gzipItemTransform) Reverse(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() //nolint:errcheck
+	return io.ReadAll(r)
+}
+
+// itemCodecs is the set of codecs that a data store knows about: the one it writes with, and any
+// others that it can read.
+type itemCodecs struct {
+	writer ItemCodec
+	byName map[string]ItemCodec
+}
+
+func makeItemCodecs(writer ItemCodec, readers []ItemCodec) itemCodecs {
+	if writer == nil {
+		writer = DefaultItemCodec()
+	}
+	ret := itemCodecs{writer: writer, byName: make(map[string]ItemCodec)}
+	ret.byName[defaultItemCodecName] = DefaultItemCodec()
+	for _, c := range readers {
+		ret.byName[c.Name()] = c
+	}
+	ret.byName[writer.Name()] = writer
+	return ret
+}
+
+// onlyDefault returns true if items are only written and read with the default codec.
+func (c itemCodecs) onlyDefault() bool {
+	return len(c.byName) == 1 && c.writer.Name() == defaultItemCodecName
+}
+
+func (c itemCodecs) encode(item ldstoretypes.SerializedItemDescriptor) (map[string]types.AttributeValue, error) {
+	attrs, err := c.writer.Encode(item)
+	if err != nil {
+		return nil, fmt.Errorf("codec %q failed to encode item: %w", c.writer.Name(), err)
+	}
+	if name := c.writer.Name(); name != defaultItemCodecName {
+		attrs[codecAttribute] = attrValueOfString(name)
+	}
+	return attrs, nil
+}
+
+func (c itemCodecs) decode(attrs map[string]types.AttributeValue) (ldstoretypes.SerializedItemDescriptor, error) {
+	name := defaultItemCodecName
+	if value, ok := attrs[codecAttribute]; ok {
+		name = attrValueToString(value)
+	}
+	codec, ok := c.byName[name]
+	if !ok {
+		return ldstoretypes.SerializedItemDescriptor{}, fmt.Errorf("item was written with unknown codec %q", name)
+	}
+	item, err := codec.Decode(attrs)
+	if err != nil {
+		return ldstoretypes.SerializedItemDescriptor{}, fmt.Errorf("codec %q failed to decode item: %w", name, err)
+	}
+	return item, nil
+}
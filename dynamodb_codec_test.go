@@ -0,0 +1,155 @@
+package lddynamodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+	"github.com/launchdarkly/go-sdk-common/v3/ldlogtest"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reverseBytesTransform struct{}
+
+func (t reverseBytesTransform) Name() string { return "reverse" }
+
+func (t reverseBytesTransform) Apply(data []byte) ([]byte, error) {
+	ret := make([]byte, len(data))
+	for i, b := range data {
+		ret[len(data)-1-i] = b
+	}
+	return ret, nil
+}
+
+func (t reverseBytesTransform) Reverse(data []byte) ([]byte, error) {
+	return t.Apply(data)
+}
+
+type failingTransform struct{}
+
+func (t failingTransform) Name() string                        { return "fail" }
+func (t failingTransform) Apply(data []byte) ([]byte, error)   { return nil, errors.New("sorry") }
+func (t failingTransform) Reverse(data []byte) ([]byte, error) { return nil, errors.New("sorry") }
+
+func TestItemCodecs(t *testing.T) {
+	item := ldstoretypes.SerializedItemDescriptor{Version: 2, SerializedItem: []byte(`{"key":"flag1","version":2}`)}
+
+	makeStore := func(writer ItemCodec, readers ...ItemCodec) *dynamoDBDataStore {
+		return &dynamoDBDataStore{prefix: "p", codecs: makeItemCodecs(writer, readers)}
+	}
+
+	t.Run("default codec produces the original format", func(t *testing.T) {
+		av, err := makeStore(nil).encodeItem(ldstoreimpl.Features(), "flag1", item)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]types.AttributeValue{
+			tablePartitionKey: attrValueOfString("p:features"),
+			tableSortKey:      attrValueOfString("flag1"),
+			versionAttribute:  attrValueOfInt(2),
+			itemJSONAttribute: attrValueOfString(string(item.SerializedItem)),
+		}, av)
+	})
+
+	t.Run("ChainedItemCodec with no transforms is the default codec", func(t *testing.T) {
+		assert.Equal(t, DefaultItemCodec(), ChainedItemCodec())
+	})
+
+	t.Run("chained codec round trip", func(t *testing.T) {
+		codec := ChainedItemCodec(GzipItemTransform(), reverseBytesTransform{})
+		assert.Equal(t, "gzip+reverse", codec.Name())
+
+		store := makeStore(codec)
+		av, err := store.encodeItem(ldstoreimpl.Features(), "flag1", item)
+		require.NoError(t, err)
+		assert.Equal(t, attrValueOfString("gzip+reverse"), av[codecAttribute])
+		assert.IsType(t, &types.AttributeValueMemberB{}, av[itemJSONAttribute])
+
+		key, decoded, err := store.decodeItem(av)
+		require.NoError(t, err)
+		assert.Equal(t, "flag1", key)
+		assert.Equal(t, item, decoded)
+	})
+
+	t.Run("items written with the default codec can always be read", func(t *testing.T) {
+		av, err := makeStore(nil).encodeItem(ldstoreimpl.Features(), "flag1", item)
+		require.NoError(t, err)
+
+		_, decoded, err := makeStore(ChainedItemCodec(GzipItemTransform())).decodeItem(av)
+		require.NoError(t, err)
+		assert.Equal(t, item, decoded)
+	})
+
+	t.Run("items written with an older codec can be read if it is configured", func(t *testing.T) {
+		oldCodec := ChainedItemCodec(reverseBytesTransform{})
+		av, err := makeStore(oldCodec).encodeItem(ldstoreimpl.Features(), "flag1", item)
+		require.NoError(t, err)
+
+		_, _, err = makeStore(ChainedItemCodec(GzipItemTransform())).decodeItem(av)
+		assert.Error(t, err)
+
+		_, decoded, err := makeStore(ChainedItemCodec(GzipItemTransform()), oldCodec).decodeItem(av)
+		require.NoError(t, err)
+		assert.Equal(t, item, decoded)
+	})
+
+	t.Run("transform errors are returned", func(t *testing.T) {
+		_, err := makeStore(ChainedItemCodec(failingTransform{})).encodeItem(ldstoreimpl.Features(), "flag1", item)
+		assert.Error(t, err)
+
+		av, err := makeStore(ChainedItemCodec(reverseBytesTransform{})).encodeItem(ldstoreimpl.Features(), "flag1", item)
+		require.NoError(t, err)
+		av[codecAttribute] = attrValueOfString("fail")
+		_, _, err = makeStore(nil, ChainedItemCodec(failingTransform{})).decodeItem(av)
+		assert.Error(t, err)
+	})
+}
+
+func TestDataStoreWithChainedCodec(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+	require.NoError(t, clearTestData(""))
+
+	data := []ldstoretypes.SerializedCollection{
+		{
+			Kind: ldstoreimpl.Features(),
+			Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+				{Key: "flag1", Item: ldstoretypes.SerializedItemDescriptor{
+					Version: 1, SerializedItem: []byte(`{"key": "flag1", "version": 1}`),
+				}},
+			},
+		},
+	}
+	codec := ChainedItemCodec(GzipItemTransform())
+
+	mockLog := ldlogtest.NewMockLog()
+	ctx := subsystems.BasicClientContext{}
+	ctx.Logging.Loggers = mockLog.Loggers
+
+	writer, err := baseDataStoreBuilder().Codec(codec).Build(ctx)
+	require.NoError(t, err)
+	defer writer.Close()
+	require.NoError(t, writer.Init(data))
+
+	items, err := writer.GetAll(ldstoreimpl.Features())
+	require.NoError(t, err)
+	assert.Equal(t, data[0].Items, items)
+
+	defaultReader, err := baseDataStoreBuilder().Build(ctx)
+	require.NoError(t, err)
+	defer defaultReader.Close()
+	items, err = defaultReader.GetAll(ldstoreimpl.Features())
+	require.NoError(t, err)
+	assert.Len(t, items, 0)
+	mockLog.AssertMessageMatch(t, true, ldlog.Error, `unknown codec "gzip"`)
+
+	migratingReader, err := baseDataStoreBuilder().Codec(DefaultItemCodec(), codec).Build(ctx)
+	require.NoError(t, err)
+	defer migratingReader.Close()
+	item, err := migratingReader.Get(ldstoreimpl.Features(), "flag1")
+	require.NoError(t, err)
+	assert.Equal(t, data[0].Items[0].Item, item)
+}
@@ -0,0 +1,75 @@
+package lddynamodb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// To keep two LaunchDarkly environments from overwriting each other's data when they have been
+// configured with the same table and prefix, Init records a fingerprint of the environment in the
+// "$inited" item, and later writes from a store with a different fingerprint are refused. This is only
+// done if the application configured an environment ID; the fingerprint is a hash of that ID.
+const initedEnvironmentAttr = "environment"
+
+// environmentRecheckInterval is how long Upsert relies on the fingerprint that the store last saw in
+// the "$inited" item before reading it again, so that if another environment initializes the table,
+// this store stops writing to it soon afterward.
+const environmentRecheckInterval = 10 * time.Second
+
+// environmentFingerprint returns the fingerprint for an environment ID, or "" if there is no ID, in
+// which case the store does not check for mismatches.
+func environmentFingerprint(environmentID string) string {
+	if environmentID == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(environmentID))
+	return hex.EncodeToString(hash[:])
+}
+
+// rememberTableEnvironment records the fingerprint that was most recently seen in the "$inited" item,
+// so that Upsert can check it without reading the item every time.
+func (store *dynamoDBDataStore) rememberTableEnvironment(fingerprint string) {
+	store.lock.Lock()
+	store.tableEnvironment = fingerprint
+	store.tableEnvironmentSeenAt = time.Now()
+	store.lock.Unlock()
+}
+
+// environmentDiffers returns true if the table was initialized by a different environment.
+func (store *dynamoDBDataStore) environmentDiffers(tableEnvironment string) bool {
+	return store.environment != "" && tableEnvironment != "" && tableEnvironment != store.environment
+}
+
+// checkEnvironment returns an error if the table was initialized by a different environment, unless
+// the application has allowed that.
+func (store *dynamoDBDataStore) checkEnvironment(tableEnvironment string) error {
+	if !store.environmentDiffers(tableEnvironment) || store.allowEnvironmentChange {
+		return nil
+	}
+	return fmt.Errorf("refusing to write to table %q with prefix %q: %w", store.table, store.prefix,
+		ErrEnvironmentMismatch)
+}
+
+// checkUpsertEnvironment is like checkEnvironment, but uses the fingerprint that the store most
+// recently saw in the "$inited" item if it would allow the write and was seen less than
+// environmentRecheckInterval ago. Otherwise it reads the item again, since the table may have been
+// initialized by another environment, or by this one, since then.
+func (store *dynamoDBDataStore) checkUpsertEnvironment(ctx context.Context) error {
+	if store.environment == "" {
+		return nil
+	}
+	store.lock.Lock()
+	tableEnvironment, seenAt := store.tableEnvironment, store.tableEnvironmentSeenAt
+	store.lock.Unlock()
+	if time.Since(seenAt) < store.environmentRecheck && store.checkEnvironment(tableEnvironment) == nil {
+		return nil
+	}
+	state, err := store.readInitState(ctx)
+	if err != nil {
+		return err
+	}
+	return store.checkEnvironment(state.environment)
+}
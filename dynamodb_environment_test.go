@@ -0,0 +1,126 @@
+package lddynamodb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvironmentFingerprint(t *testing.T) {
+	assert.Equal(t, "", environmentFingerprint(""))
+	assert.Len(t, environmentFingerprint("env1"), 64)
+	assert.NotContains(t, environmentFingerprint("env1"), "env1")
+	assert.Equal(t, environmentFingerprint("env1"), environmentFingerprint("env1"))
+	assert.NotEqual(t, environmentFingerprint("env1"), environmentFingerprint("env2"))
+}
+
+func TestDataStoreEnvironmentGuard(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	item := ldstoretypes.SerializedItemDescriptor{Version: 1, SerializedItem: []byte(`{}`)}
+	allData := []ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{{Key: "flag1", Item: item}}},
+	}
+
+	makeStore := func(t *testing.T, builder *StoreBuilder[subsystems.PersistentDataStore],
+		sdkKey string) subsystems.PersistentDataStore {
+		store, err := builder.Build(subsystems.BasicClientContext{SDKKey: sdkKey})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	}
+
+	t.Run("store from a different environment cannot write", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store1 := makeStore(t, baseDataStoreBuilder().EnvironmentID("env1"), "")
+		require.NoError(t, store1.Init(allData))
+
+		store2 := makeStore(t, baseDataStoreBuilder().EnvironmentID("env2"), "")
+		err := store2.Init(allData)
+		assert.True(t, errors.Is(err, ErrEnvironmentMismatch))
+		_, err = store2.Upsert(ldstoreimpl.Features(), "flag1", ldstoretypes.SerializedItemDescriptor{Version: 2})
+		assert.True(t, errors.Is(err, ErrEnvironmentMismatch))
+		_, err = store2.(BatchUpserter).UpsertMany([]UpsertItem{{Kind: ldstoreimpl.Features(), Key: "flag1",
+			Item: ldstoretypes.SerializedItemDescriptor{Version: 2}}})
+		assert.True(t, errors.Is(err, ErrEnvironmentMismatch))
+
+		result, err := store1.Get(ldstoreimpl.Features(), "flag1")
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Version)
+
+		updated, err := store1.Upsert(ldstoreimpl.Features(), "flag1", ldstoretypes.SerializedItemDescriptor{Version: 2})
+		require.NoError(t, err)
+		assert.True(t, updated)
+	})
+
+	t.Run("environment is not checked if there is no environment ID", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		require.NoError(t, makeStore(t, baseDataStoreBuilder(), "key1").Init(allData))
+		require.NoError(t, makeStore(t, baseDataStoreBuilder(), "key2").Init(allData))
+	})
+
+	t.Run("refused write checks the table again", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		require.NoError(t, makeStore(t, baseDataStoreBuilder().EnvironmentID("env1"), "").Init(allData))
+
+		store := makeStore(t, baseDataStoreBuilder().EnvironmentID("env2"), "")
+		_, err := store.Upsert(ldstoreimpl.Features(), "flag1", ldstoretypes.SerializedItemDescriptor{Version: 2})
+		assert.True(t, errors.Is(err, ErrEnvironmentMismatch))
+
+		require.NoError(t, makeStore(t, baseDataStoreBuilder().EnvironmentID("env2").AllowEnvironmentChange(), "").
+			Init(allData))
+		updated, err := store.Upsert(ldstoreimpl.Features(), "flag1", ldstoretypes.SerializedItemDescriptor{Version: 2})
+		require.NoError(t, err)
+		assert.True(t, updated)
+	})
+
+	t.Run("write is refused after another environment initializes the table", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store := makeStore(t, baseDataStoreBuilder().EnvironmentID("env1"), "")
+		require.NoError(t, store.Init(allData))
+		updated, err := store.Upsert(ldstoreimpl.Features(), "flag1", ldstoretypes.SerializedItemDescriptor{Version: 2})
+		require.NoError(t, err)
+		assert.True(t, updated)
+
+		require.NoError(t, makeStore(t, baseDataStoreBuilder().EnvironmentID("env2").AllowEnvironmentChange(), "").
+			Init(allData))
+
+		// Until the remembered fingerprint is rechecked, the store can still write
+		updated, err = store.Upsert(ldstoreimpl.Features(), "flag1", ldstoretypes.SerializedItemDescriptor{Version: 3})
+		require.NoError(t, err)
+		assert.True(t, updated)
+
+		store.(*dynamoDBDataStore).environmentRecheck = time.Millisecond
+		time.Sleep(2 * time.Millisecond)
+		_, err = store.Upsert(ldstoreimpl.Features(), "flag1", ldstoretypes.SerializedItemDescriptor{Version: 4})
+		assert.True(t, errors.Is(err, ErrEnvironmentMismatch))
+	})
+
+	t.Run("table without a fingerprint can be written by any environment", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		require.NoError(t, makeStore(t, baseDataStoreBuilder(), "").Init(allData))
+		require.NoError(t, makeStore(t, baseDataStoreBuilder().EnvironmentID("env1"), "").Init(allData))
+		require.NoError(t, makeStore(t, baseDataStoreBuilder(), "").Init(allData))
+	})
+
+	t.Run("override allows a different environment to take over", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store1 := makeStore(t, baseDataStoreBuilder().EnvironmentID("env1"), "")
+		require.NoError(t, store1.Init(allData))
+
+		store2 := makeStore(t, baseDataStoreBuilder().EnvironmentID("env2").AllowEnvironmentChange(), "")
+		require.NoError(t, store2.Init(allData))
+		updated, err := store2.Upsert(ldstoreimpl.Features(), "flag1", ldstoretypes.SerializedItemDescriptor{Version: 2})
+		require.NoError(t, err)
+		assert.True(t, updated)
+
+		assert.True(t, errors.Is(store1.Init(allData), ErrEnvironmentMismatch))
+	})
+}
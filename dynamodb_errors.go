@@ -0,0 +1,109 @@
+package lddynamodb
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// Errors that the data store and the Big Segment store can return. They are wrapped in errors that
+// describe what the store was doing, so use errors.Is to check for them. When one of them is caused
+// by an error from DynamoDB, the DynamoDB error is also in the chain, so errors.As can be used to get
+// it, for instance as a *types.ResourceNotFoundException or a smithy.APIError.
+var (
+	// ErrTableNotFound means that the DynamoDB table does not exist.
+	ErrTableNotFound = errors.New("DynamoDB table not found")
+
+	// ErrThrottled means that a request was rejected because the table's capacity or the account's
+	// request rate was exceeded, even after the AWS SDK's retries, or because of the store's own
+	// limit; see [StoreBuilder.ReadCapacityLimit].
+	ErrThrottled = errors.New("DynamoDB request was throttled")
+
+	// ErrAccessDenied means that the AWS credentials are invalid, or do not allow the request.
+	ErrAccessDenied = errors.New("access to DynamoDB was denied")
+
+	// ErrItemTooLarge means that DynamoDB rejected an item because it was larger than the item size
+	// limit.
+	//
+	// This is rare: before writing an item, the store checks its size itself, and if it is too large,
+	// the store logs an error and drops the item without returning an error, so errors.Is will not
+	// see ErrItemTooLarge in that case; if [StoreBuilder.Metrics] is set, those items are counted with
+	// Metrics.IncrementItemsTooLarge instead. A partition that has exceeded DynamoDB's item collection
+	// size limit, which only happens for tables with local secondary indexes, is not reported as
+	// ErrItemTooLarge.
+	ErrItemTooLarge = errors.New("item is too large to store in DynamoDB")
+
+	// ErrStoreClosed means that the operation failed because the store was closed.
+	ErrStoreClosed = errors.New("the store has been closed")
+
+	// ErrReadOnly means that a write was refused because of [StoreBuilder.ReadOnlyWithErrors].
+	ErrReadOnly = errors.New("the data store is read-only")
+
+	// ErrEnvironmentMismatch means that a write was refused because the table belongs to a different
+	// LaunchDarkly environment; see [StoreBuilder.EnvironmentID].
+	ErrEnvironmentMismatch = errors.New("the table was initialized by a different LaunchDarkly environment")
+
+	// ErrVersionRegression means that Init was refused because of [VersionRegressionRefuse].
+	ErrVersionRegression = errors.New("data set contains items older than the ones in the store")
+)
+
+// storeError adds one of the exported errors to the chain of an error that is more specific.
+type storeError struct {
+	kind error
+	err  error
+}
+
+func (e *storeError) Error() string        { return e.err.Error() }
+func (e *storeError) Unwrap() error        { return e.err }
+func (e *storeError) Is(target error) bool { return target == e.kind }
+
+// classifyError adds the exported error that describes err to its chain, if there is one. The
+// context is the store's own context, which is cancelled when the store is closed.
+func classifyError(storeContext context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var classified *storeError
+	if errors.As(err, &classified) {
+		return err
+	}
+	if kind := errorKind(storeContext, err); kind != nil {
+		return &storeError{kind: kind, err: err}
+	}
+	return err
+}
+
+func errorKind(storeContext context.Context, err error) error {
+	if storeContext.Err() != nil && errors.Is(err, context.Canceled) {
+		return ErrStoreClosed
+	}
+	var canceledErr *types.TransactionCanceledException
+	if errors.As(err, &canceledErr) {
+		for _, reason := range canceledErr.CancellationReasons {
+			if code := aws.ToString(reason.Code); code == "ThrottlingError" || code == "ProvisionedThroughputExceeded" {
+				return ErrThrottled // COVERAGE: can't cause this in unit tests
+			}
+		}
+	}
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return nil
+	}
+	switch apiErr.ErrorCode() {
+	case "ResourceNotFoundException":
+		return ErrTableNotFound
+	case "ProvisionedThroughputExceededException", "RequestLimitExceeded", "ThrottlingException":
+		return ErrThrottled // COVERAGE: can't cause this in unit tests
+	case "AccessDeniedException", "UnrecognizedClientException":
+		return ErrAccessDenied // COVERAGE: can't cause this in unit tests
+	case "ValidationException":
+		if strings.Contains(apiErr.ErrorMessage(), "Item size") {
+			return ErrItemTooLarge // COVERAGE: can't cause this in unit tests
+		}
+	}
+	return nil
+}
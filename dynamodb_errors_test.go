@@ -0,0 +1,129 @@
+package lddynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	apiError := func(code, message string) error {
+		return &smithy.OperationError{ServiceID: "DynamoDB", OperationName: "PutItem",
+			Err: &smithy.GenericAPIError{Code: code, Message: message}}
+	}
+	canceled := func(reasons ...string) error {
+		e := &types.TransactionCanceledException{}
+		for _, r := range reasons {
+			e.CancellationReasons = append(e.CancellationReasons, types.CancellationReason{Code: aws.String(r)})
+		}
+		return e
+	}
+
+	for _, p := range []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"table not found", &types.ResourceNotFoundException{}, ErrTableNotFound},
+		{"provisioned throughput", &types.ProvisionedThroughputExceededException{}, ErrThrottled},
+		{"request limit", &types.RequestLimitExceeded{}, ErrThrottled},
+		{"throttling", apiError("ThrottlingException", ""), ErrThrottled},
+		{"access denied", apiError("AccessDeniedException", ""), ErrAccessDenied},
+		{"invalid credentials", apiError("UnrecognizedClientException", ""), ErrAccessDenied},
+		{"item size", apiError("ValidationException", "Item size has exceeded the maximum allowed size"),
+			ErrItemTooLarge},
+		{"throttled transaction", canceled("None", "ThrottlingError"), ErrThrottled},
+	} {
+		t.Run(p.name, func(t *testing.T) {
+			err := classifyError(context.Background(), fmt.Errorf("failed to do something: %w", p.err))
+			assert.True(t, errors.Is(err, p.expected))
+			assert.True(t, errors.Is(err, p.err))
+			assert.Equal(t, "failed to do something: "+p.err.Error(), err.Error())
+		})
+	}
+
+	t.Run("other errors are unchanged", func(t *testing.T) {
+		for _, err := range []error{
+			errors.New("sorry"),
+			apiError("ValidationException", "One or more parameter values were invalid"),
+			canceled("ConditionalCheckFailed"),
+			&types.ItemCollectionSizeLimitExceededException{},
+			canceled("ItemCollectionSizeLimitExceeded", "None"),
+			context.Canceled,
+		} {
+			assert.Equal(t, err, classifyError(context.Background(), err))
+		}
+		assert.Nil(t, classifyError(context.Background(), nil))
+	})
+
+	t.Run("cancellation of the store's context means the store was closed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.True(t, errors.Is(classifyError(ctx, fmt.Errorf("oops: %w", context.Canceled)), ErrStoreClosed))
+	})
+
+	t.Run("read capacity limit is throttling", func(t *testing.T) {
+		assert.True(t, errors.Is(fmt.Errorf("failed: %w", errReadCapacityExceeded), ErrThrottled))
+	})
+}
+
+func TestStoreErrorsCanBeIdentified(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	t.Run("table not found", func(t *testing.T) {
+		store, err := DataStore("nonexistent-table").ClientOptions(makeTestOptions()).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+
+		_, err = store.Get(ldstoreimpl.Features(), "flag1")
+		assert.True(t, errors.Is(err, ErrTableNotFound))
+		var awsErr *types.ResourceNotFoundException
+		assert.True(t, errors.As(err, &awsErr))
+
+		_, err = store.GetAll(ldstoreimpl.Features())
+		assert.True(t, errors.Is(err, ErrTableNotFound))
+
+		err = store.Init([]ldstoretypes.SerializedCollection{{Kind: ldstoreimpl.Features()}})
+		assert.True(t, errors.Is(err, ErrTableNotFound))
+		assert.True(t, errors.As(err, &awsErr))
+
+		_, err = store.Upsert(ldstoreimpl.Features(), "flag1",
+			ldstoretypes.SerializedItemDescriptor{Version: 1, SerializedItem: []byte(`{}`)})
+		assert.True(t, errors.Is(err, ErrTableNotFound))
+
+		bigSegmentStore, err := BigSegmentStore("nonexistent-table").ClientOptions(makeTestOptions()).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer bigSegmentStore.Close()
+		_, err = bigSegmentStore.GetMembership("abc")
+		assert.True(t, errors.Is(err, ErrTableNotFound))
+	})
+
+	t.Run("store closed", func(t *testing.T) {
+		store, err := baseDataStoreBuilder().Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+		_, err = store.Get(ldstoreimpl.Features(), "flag1")
+		assert.True(t, errors.Is(err, ErrStoreClosed))
+		assert.True(t, errors.Is(err, context.Canceled))
+
+		bigSegmentStore, err := BigSegmentStore(testTableName).ClientOptions(makeTestOptions()).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		require.NoError(t, bigSegmentStore.Close())
+		_, err = bigSegmentStore.GetMetadata()
+		assert.True(t, errors.Is(err, ErrStoreClosed))
+	})
+}
@@ -0,0 +1,392 @@
+package lddynamodb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// A fallback snapshot is a local copy of the most recent data that the store read from DynamoDB with
+// GetAll, so that if DynamoDB cannot be reached, for instance when an application starts during an
+// outage, the store can still return that data. It is only used for reading; see
+// StoreBuilder.FallbackSnapshotFile.
+
+// This is the format of the snapshot file, which is also used for the packed snapshot that Init can
+// write to DynamoDB (see dynamodb_packed_snapshot.go). Items are kept per data kind, since GetAll
+// reads one kind at a time.
+type snapshotData struct {
+	SavedAt int64                         `json:"savedAt"`
+	Kinds   map[string][]snapshotDataItem `json:"kinds"`
+}
+
+type snapshotDataItem struct {
+	Key     string `json:"key"`
+	Version int    `json:"version"`
+	Deleted bool   `json:"deleted,omitempty"`
+	Item    []byte `json:"item,omitempty"`
+}
+
+func encodeSnapshotData(
+	kinds map[string][]ldstoretypes.KeyedSerializedItemDescriptor,
+	savedAt time.Time,
+) ([]byte, error) {
+	data := snapshotData{
+		SavedAt: savedAt.UnixMilli(),
+		Kinds:   make(map[string][]snapshotDataItem, len(kinds)),
+	}
+	for kindName, items := range kinds {
+		dataItems := make([]snapshotDataItem, 0, len(items))
+		for _, item := range items {
+			dataItems = append(dataItems, snapshotDataItem{
+				Key:     item.Key,
+				Version: item.Item.Version,
+				Deleted: item.Item.Deleted,
+				Item:    item.Item.SerializedItem,
+			})
+		}
+		data.Kinds[kindName] = dataItems
+	}
+	return json.Marshal(data)
+}
+
+// decodeSnapshotData returns the items for each kind, and the time when they were saved, which is
+// zero if it is unknown.
+func decodeSnapshotData(
+	encoded []byte,
+) (map[string][]ldstoretypes.KeyedSerializedItemDescriptor, time.Time, error) {
+	var data snapshotData
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, time.Time{}, err
+	}
+	kinds := make(map[string][]ldstoretypes.KeyedSerializedItemDescriptor, len(data.Kinds))
+	for kindName, dataItems := range data.Kinds {
+		items := make([]ldstoretypes.KeyedSerializedItemDescriptor, 0, len(dataItems))
+		for _, dataItem := range dataItems {
+			items = append(items, ldstoretypes.KeyedSerializedItemDescriptor{
+				Key: dataItem.Key,
+				Item: ldstoretypes.SerializedItemDescriptor{
+					Version:        dataItem.Version,
+					Deleted:        dataItem.Deleted,
+					SerializedItem: dataItem.Item,
+				},
+			})
+		}
+		kinds[kindName] = items
+	}
+	var savedAt time.Time
+	if data.SavedAt > 0 {
+		savedAt = time.UnixMilli(data.SavedAt)
+	}
+	return kinds, savedAt, nil
+}
+
+// fallbackSnapshotWriteDelay is how long the snapshot waits after its data changes before it rewrites
+// the file, so that several changes in a row, such as the SDK reading each kind in turn, only cause
+// one write.
+const fallbackSnapshotWriteDelay = time.Second
+
+type fallbackSnapshot struct {
+	path      string
+	loggers   ldlog.Loggers
+	changed   chan struct{}
+	closeChan chan struct{}
+	closeOnce sync.Once
+	doneChan  chan struct{}
+
+	lock    sync.Mutex
+	kinds   map[string][]ldstoretypes.KeyedSerializedItemDescriptor
+	index   map[string]map[string]int // the position of each key in kinds
+	savedAt time.Time
+	dirty   bool
+	serving bool
+}
+
+// newFallbackSnapshot returns nil if path is empty, meaning that the option is disabled; all of the
+// methods can be called on a nil *fallbackSnapshot. If the file already exists, its contents are
+// loaded so they can be used before the store has read anything from DynamoDB.
+func newFallbackSnapshot(path string, loggers ldlog.Loggers) *fallbackSnapshot {
+	if path == "" {
+		return nil
+	}
+	s := &fallbackSnapshot{
+		path:      path,
+		loggers:   loggers,
+		changed:   make(chan struct{}, 1),
+		closeChan: make(chan struct{}),
+		doneChan:  make(chan struct{}),
+		kinds:     make(map[string][]ldstoretypes.KeyedSerializedItemDescriptor),
+		index:     make(map[string]map[string]int),
+	}
+	s.load()
+	go s.runWriter()
+	return s
+}
+
+// load reads the file, if it exists, when the snapshot is created.
+func (s *fallbackSnapshot) load() {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			s.loggers.Warnf("Unable to read fallback snapshot file %q: %s", s.path, err)
+		}
+		return
+	}
+	kinds, savedAt, err := decodeSnapshotData(data)
+	if err != nil {
+		s.loggers.Warnf("Ignoring invalid fallback snapshot file %q: %s", s.path, err)
+		return
+	}
+	for kindName, items := range kinds {
+		s.setItems(kindName, items)
+	}
+	s.savedAt = savedAt
+}
+
+// canUseFallbackSnapshot returns true if a read from DynamoDB failed in a way that means DynamoDB is
+// unreachable or overloaded: a network error, a timeout, throttling, or a server error. Other errors,
+// such as invalid credentials, a missing table, or an invalid request, would not be fixed by waiting,
+// so hiding them behind stale data would only delay finding out about them.
+func canUseFallbackSnapshot(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if errorKind(context.Background(), err) == ErrThrottled {
+			return true // COVERAGE: can't cause this in unit tests
+		}
+		var respErr *smithyhttp.ResponseError
+		return errors.As(err, &respErr) && respErr.HTTPStatusCode() >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// hasData returns true if the snapshot contains data for at least one kind.
+func (s *fallbackSnapshot) hasData() bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.kinds) > 0
+}
+
+// save replaces the snapshot's items for one kind with the result of a successful GetAll. If they are
+// different from the items it already had, the file is rewritten in the background. Since reads from
+// DynamoDB have succeeded, this also ends any period in which the snapshot was being served.
+func (s *fallbackSnapshot) save(kind ldstoretypes.DataKind, items []ldstoretypes.KeyedSerializedItemDescriptor) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.setAvailable()
+	if s.sameItems(kind.GetName(), items) {
+		return
+	}
+	s.setItems(kind.GetName(), items)
+	s.savedAt = time.Now()
+	s.dirty = true
+	select {
+	case s.changed <- struct{}{}:
+	default: // the writer has already been told about an earlier change
+	}
+}
+
+// setItems replaces the items for a kind. The caller must hold the lock, unless the snapshot is being
+// loaded.
+func (s *fallbackSnapshot) setItems(kindName string, items []ldstoretypes.KeyedSerializedItemDescriptor) {
+	index := make(map[string]int, len(items))
+	for i, item := range items {
+		index[item.Key] = i
+	}
+	s.kinds[kindName] = items
+	s.index[kindName] = index
+}
+
+// sameItems returns true if the snapshot already has the same items for a kind, in any order. The
+// caller must hold the lock.
+func (s *fallbackSnapshot) sameItems(kindName string, items []ldstoretypes.KeyedSerializedItemDescriptor) bool {
+	oldItems, ok := s.kinds[kindName]
+	if !ok || len(oldItems) != len(items) {
+		return false
+	}
+	index := s.index[kindName]
+	for _, item := range items {
+		i, ok := index[item.Key]
+		if !ok {
+			return false
+		}
+		old := oldItems[i].Item
+		if old.Version != item.Item.Version || old.Deleted != item.Item.Deleted ||
+			!bytes.Equal(old.SerializedItem, item.Item.SerializedItem) {
+			return false
+		}
+	}
+	return true
+}
+
+// runWriter rewrites the file after the data changes, waiting for fallbackSnapshotWriteDelay first
+// so that changes that happen close together are written at once. When the snapshot is closed, any
+// change that has not been written yet is written before it returns.
+func (s *fallbackSnapshot) runWriter() {
+	defer close(s.doneChan)
+	for {
+		select {
+		case <-s.closeChan:
+			s.writeIfChanged()
+			return
+		case <-s.changed:
+		}
+		timer := time.NewTimer(fallbackSnapshotWriteDelay)
+		select {
+		case <-s.closeChan:
+			timer.Stop()
+			s.writeIfChanged()
+			return
+		case <-timer.C:
+			s.writeIfChanged()
+		}
+	}
+}
+
+func (s *fallbackSnapshot) writeIfChanged() {
+	s.lock.Lock()
+	if !s.dirty {
+		s.lock.Unlock()
+		return
+	}
+	s.dirty = false
+	data, err := encodeSnapshotData(s.kinds, s.savedAt)
+	s.lock.Unlock()
+	if err == nil {
+		err = s.write(data)
+	}
+	if err != nil {
+		s.loggers.Warnf("Unable to write fallback snapshot file %q: %s", s.path, err)
+	}
+}
+
+// close stops the background writer, after writing any change that it has not written yet.
+func (s *fallbackSnapshot) close() {
+	if s == nil {
+		return
+	}
+	s.closeOnce.Do(func() {
+		close(s.closeChan)
+		<-s.doneChan
+	})
+}
+
+// write saves the encoded snapshot to a temporary file in the same directory and then renames it, so
+// that a reader never sees a partly written file. Only the background writer calls it.
+func (s *fallbackSnapshot) write(data []byte) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	_, err = tempFile.Write(data)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tempPath) // COVERAGE: can't cause this in unit tests
+	}
+	return err
+}
+
+// getAll returns the snapshot's items for a kind, if it has any, after a GetAll from DynamoDB failed
+// with the specified error.
+func (s *fallbackSnapshot) getAll(
+	kind ldstoretypes.DataKind,
+	err error,
+) ([]ldstoretypes.KeyedSerializedItemDescriptor, bool) {
+	if s == nil || !canUseFallbackSnapshot(err) {
+		return nil, false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	items, ok := s.kinds[kind.GetName()]
+	if !ok {
+		return nil, false
+	}
+	s.setServing(err)
+	return items, true
+}
+
+// get returns the snapshot's item for a key, after a Get from DynamoDB failed with the specified
+// error. If the snapshot has data for the kind but not for the key, it returns a not-found result.
+func (s *fallbackSnapshot) get(
+	kind ldstoretypes.DataKind,
+	key string,
+	err error,
+) (ldstoretypes.SerializedItemDescriptor, bool) {
+	if s == nil || !canUseFallbackSnapshot(err) {
+		return ldstoretypes.SerializedItemDescriptor{}.NotFound(), false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	items, ok := s.kinds[kind.GetName()]
+	if !ok {
+		return ldstoretypes.SerializedItemDescriptor{}.NotFound(), false
+	}
+	s.setServing(err)
+	if i, ok := s.index[kind.GetName()][key]; ok {
+		return items[i].Item, true
+	}
+	return ldstoretypes.SerializedItemDescriptor{}.NotFound(), true
+}
+
+// markAvailable is called when a read from DynamoDB succeeds.
+func (s *fallbackSnapshot) markAvailable() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.setAvailable()
+	s.lock.Unlock()
+}
+
+// setServing logs a warning the first time the snapshot is used after DynamoDB becomes unreachable.
+// The caller must hold the lock.
+func (s *fallbackSnapshot) setServing(err error) {
+	if s.serving {
+		return
+	}
+	s.serving = true
+	savedAt := "at an unknown time"
+	if !s.savedAt.IsZero() {
+		savedAt = "at " + s.savedAt.UTC().Format(time.RFC3339)
+	}
+	s.loggers.Warnf("DynamoDB is unavailable (%s); serving stale data from fallback snapshot file %q, saved %s",
+		err, s.path, savedAt)
+}
+
+// setAvailable logs a message if the snapshot was being used. The caller must hold the lock.
+func (s *fallbackSnapshot) setAvailable() {
+	if !s.serving {
+		return
+	}
+	s.serving = false
+	s.loggers.Info("DynamoDB is available again; no longer serving data from the fallback snapshot file")
+}
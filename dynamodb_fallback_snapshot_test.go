@@ -0,0 +1,196 @@
+package lddynamodb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+	"github.com/launchdarkly/go-sdk-common/v3/ldlogtest"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataStoreFallbackSnapshot(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	flag1 := ldstoretypes.KeyedSerializedItemDescriptor{
+		Key: "flag1", Item: ldstoretypes.SerializedItemDescriptor{Version: 1, SerializedItem: []byte(`{"key":"flag1"}`)},
+	}
+	flag2 := ldstoretypes.KeyedSerializedItemDescriptor{
+		Key: "flag2", Item: ldstoretypes.SerializedItemDescriptor{Version: 2, SerializedItem: []byte(`{"key":"flag2"}`)},
+	}
+	data := []ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{flag1, flag2}},
+		{Kind: ldstoreimpl.Segments(), Items: nil},
+	}
+
+	makeStore := func(
+		t *testing.T,
+		builder *StoreBuilder[subsystems.PersistentDataStore],
+	) (*dynamoDBDataStore, *ldlogtest.MockLog) {
+		mockLog := ldlogtest.NewMockLog()
+		ctx := subsystems.BasicClientContext{}
+		ctx.Logging.Loggers = mockLog.Loggers
+		store, err := builder.Build(ctx)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store.(*dynamoDBDataStore), mockLog
+	}
+
+	// writeSnapshot creates a snapshot file containing the flags from the test data.
+	writeSnapshot := func(t *testing.T) string {
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		require.NoError(t, clearTestData(""))
+		store, _ := makeStore(t, baseDataStoreBuilder().FallbackSnapshotFile(path))
+		require.NoError(t, store.Init(data))
+		items, err := store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, data[0].Items, items)
+		require.NoError(t, store.Close()) // writes the file without waiting for the delay
+		require.FileExists(t, path)
+		return path
+	}
+
+	// unreachableStore returns a builder for a store whose requests fail because nothing is listening
+	// at the DynamoDB endpoint.
+	unreachableStore := func() *StoreBuilder[subsystems.PersistentDataStore] {
+		options := makeTestOptions()
+		options.EndpointResolver = dynamodb.EndpointResolverFromURL("http://localhost:1", func(e *aws.Endpoint) {
+			e.SigningRegion = "us-east-1"
+		})
+		options.RetryMaxAttempts = 1
+		return DataStore(testTableName).ClientOptions(options)
+	}
+
+	t.Run("snapshot is written atomically after GetAll", func(t *testing.T) {
+		path := writeSnapshot(t)
+		entries, err := os.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		require.Len(t, entries, 1) // no temporary files are left behind
+		assert.Equal(t, "snapshot.json", entries[0].Name())
+
+		loaded := newFallbackSnapshot(path, ldlog.NewDisabledLoggers())
+		defer loaded.close()
+		items, ok := loaded.getAll(ldstoreimpl.Features(), context.DeadlineExceeded)
+		require.True(t, ok)
+		assert.ElementsMatch(t, data[0].Items, items)
+		_, ok = loaded.getAll(ldstoreimpl.Segments(), context.DeadlineExceeded)
+		assert.False(t, ok)
+	})
+
+	t.Run("snapshot is rewritten only if the data changed", func(t *testing.T) {
+		path := writeSnapshot(t)
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+
+		store, _ := makeStore(t, baseDataStoreBuilder().FallbackSnapshotFile(path))
+		_, err = store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+		unchangedInfo, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, info.ModTime(), unchangedInfo.ModTime())
+
+		store, _ = makeStore(t, baseDataStoreBuilder().FallbackSnapshotFile(path))
+		_, err = store.Upsert(ldstoreimpl.Features(), "flag1", ldstoretypes.SerializedItemDescriptor{Version: 5})
+		require.NoError(t, err)
+		_, err = store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+		changedInfo, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.NotEqual(t, info.ModTime(), changedInfo.ModTime())
+	})
+
+	t.Run("snapshot is served when DynamoDB is unavailable", func(t *testing.T) {
+		path := writeSnapshot(t)
+		store, mockLog := makeStore(t, unreachableStore().FallbackSnapshotFile(path))
+
+		assert.False(t, store.IsStoreAvailable())
+		assert.True(t, store.IsInitialized())
+
+		items, err := store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, data[0].Items, items)
+
+		item, err := store.Get(ldstoreimpl.Features(), "flag2")
+		require.NoError(t, err)
+		assert.Equal(t, flag2.Item, item)
+
+		item, err = store.Get(ldstoreimpl.Features(), "unknown")
+		require.NoError(t, err)
+		assert.Equal(t, -1, item.Version)
+
+		// The snapshot has no segments, because the writer never read them
+		_, err = store.GetAll(ldstoreimpl.Segments())
+		assert.Error(t, err)
+
+		_, err = store.Upsert(ldstoreimpl.Features(), "flag1", flag2.Item)
+		assert.Error(t, err)
+
+		assert.Len(t, mockLog.GetOutput(ldlog.Warn), 1)
+		mockLog.AssertMessageMatch(t, true, ldlog.Warn, "serving stale data from fallback snapshot file")
+	})
+
+	t.Run("store logs when DynamoDB is available again", func(t *testing.T) {
+		path := writeSnapshot(t)
+		store, mockLog := makeStore(t, baseDataStoreBuilder().FallbackSnapshotFile(path))
+
+		_, ok := store.snapshot.getAll(ldstoreimpl.Features(), context.DeadlineExceeded)
+		require.True(t, ok)
+		mockLog.AssertMessageMatch(t, true, ldlog.Warn, "serving stale data")
+
+		_, err := store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		mockLog.AssertMessageMatch(t, true, ldlog.Info, "DynamoDB is available again")
+	})
+
+	t.Run("snapshot is not served for errors that are not caused by an outage", func(t *testing.T) {
+		path := writeSnapshot(t)
+		store, _ := makeStore(t, DataStore("nonexistent-table").ClientOptions(makeTestOptions()).
+			FallbackSnapshotFile(path))
+
+		assert.False(t, store.IsInitialized())
+		_, err := store.GetAll(ldstoreimpl.Features())
+		assert.True(t, errors.Is(err, ErrTableNotFound))
+		_, err = store.Get(ldstoreimpl.Features(), "flag1")
+		assert.True(t, errors.Is(err, ErrTableNotFound))
+
+		assert.False(t, canUseFallbackSnapshot(errors.New("sorry")))
+		assert.False(t, canUseFallbackSnapshot(context.Canceled))
+	})
+
+	t.Run("store without a snapshot file fails as usual", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		store, _ := makeStore(t, DataStore(testTableName).FallbackSnapshotFile(path))
+
+		assert.False(t, store.IsInitialized())
+		_, err := store.GetAll(ldstoreimpl.Features())
+		assert.Error(t, err)
+		_, err = store.Get(ldstoreimpl.Features(), "flag1")
+		assert.Error(t, err)
+		assert.NoFileExists(t, path)
+	})
+
+	t.Run("invalid snapshot file is ignored", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		require.NoError(t, os.WriteFile(path, []byte("not JSON"), 0o600))
+		store, mockLog := makeStore(t, DataStore(testTableName).FallbackSnapshotFile(path))
+
+		assert.False(t, store.IsInitialized())
+		_, err := store.GetAll(ldstoreimpl.Features())
+		assert.Error(t, err)
+		mockLog.AssertMessageMatch(t, true, ldlog.Warn, "Ignoring invalid fallback snapshot file")
+	})
+}
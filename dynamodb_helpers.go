@@ -2,8 +2,11 @@ package lddynamodb
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
@@ -19,6 +22,10 @@ func attrValueOfInt(value int) types.AttributeValue {
 	return &types.AttributeValueMemberN{Value: strconv.Itoa(value)}
 }
 
+func attrValueOfUint64(value uint64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatUint(value, 10)}
+}
+
 func attrValueToString(value types.AttributeValue) string {
 	switch v := value.(type) {
 	case *types.AttributeValueMemberS:
@@ -30,6 +37,32 @@ func attrValueToString(value types.AttributeValue) string {
 	}
 }
 
+// attrValueSize returns the number of bytes that DynamoDB counts toward the item size for a value.
+func attrValueSize(value types.AttributeValue) int {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return len(v.Value)
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberSS:
+		size := 0
+		for _, s := range v.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		size := 0
+		for k, v := range v.Value {
+			size += len(k) + attrValueSize(v)
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
 func attrValueToInt(value types.AttributeValue) int {
 	switch v := value.(type) {
 	case *types.AttributeValueMemberN:
@@ -54,6 +87,16 @@ func attrValueToUint64(value types.AttributeValue) uint64 {
 	}
 }
 
+const (
+	// batchWriteMaxItems is the maximum number of requests that BatchWriteItem can handle.
+	batchWriteMaxItems = 25
+
+	// batchWriteMaxAttempts is how many times we will send the same batch if DynamoDB reports that
+	// some of its items were not processed, which happens when the table's capacity is exceeded.
+	batchWriteMaxAttempts = 5
+	batchWriteRetryDelay  = 50 * time.Millisecond
+)
+
 // batchWriteRequests executes a list of write requests (PutItem or DeleteItem)
 // in batches of 25, which is the maximum BatchWriteItem can handle.
 func batchWriteRequests(
@@ -61,52 +104,144 @@ func batchWriteRequests(
 	client *dynamodb.Client,
 	table string,
 	requests []types.WriteRequest,
+	metrics *storeMetrics,
+	optFns ...func(*dynamodb.Options),
 ) error {
 	for len(requests) > 0 {
-		batchSize := int(math.Min(float64(len(requests)), 25))
+		batchSize := int(math.Min(float64(len(requests)), batchWriteMaxItems))
 		batch := requests[:batchSize]
 		requests = requests[batchSize:]
 
-		_, err := client.BatchWriteItem(context, &dynamodb.BatchWriteItemInput{
+		input := &dynamodb.BatchWriteItemInput{
 			RequestItems: map[string][]types.WriteRequest{table: batch},
-		})
-		if err != nil {
-			// COVERAGE: can't simulate this condition in unit tests because we will only get this
-			// far if the initial query in Init() already succeeded, and we don't have the ability
-			// to make DynamoDB fail *selectively* within a single test
-			return err
+		}
+		for attempt := 1; ; attempt++ {
+			out, err := client.BatchWriteItem(context, input, optFns...)
+			if err != nil {
+				// COVERAGE: can't simulate this condition in unit tests because we will only get this
+				// far if the initial query in Init() already succeeded, and we don't have the ability
+				// to make DynamoDB fail *selectively* within a single test
+				return err
+			}
+			if len(out.UnprocessedItems) == 0 {
+				break
+			}
+			// COVERAGE: the local DynamoDB instance used in unit tests never returns unprocessed items
+			if attempt == batchWriteMaxAttempts {
+				return &storeError{kind: ErrThrottled, err: fmt.Errorf("%d item(s) were still unprocessed after %d attempts",
+					len(out.UnprocessedItems[table]), attempt)}
+			}
+			metrics.batchRetry(table, len(out.UnprocessedItems[table]))
+			select {
+			case <-context.Done():
+				return context.Err()
+			case <-time.After(batchWriteRetryDelay * time.Duration(1<<(attempt-1))):
+			}
+			input.RequestItems = out.UnprocessedItems
 		}
 	}
 	return nil
 }
 
+// runConcurrently calls fn once for each index from 0 to count-1, running at most concurrency calls
+// at a time. If any call returns an error, the context passed to the other calls is cancelled, no more
+// calls are started, and the first error is returned.
+func runConcurrently(
+	ctx context.Context,
+	concurrency int,
+	count int,
+	fn func(ctx context.Context, index int) error,
+) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	semaphore := make(chan struct{}, concurrency)
+	for i := 0; i < count; i++ {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(index int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			if err := fn(ctx, index); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	if firstErr == nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// makeClientAndContext returns the DynamoDB client that a store should use, and a context for the
+// store's operations. The returned cancel function stops any pending operations; if the client came
+// from a SharedClient, it also releases the store's reference to it.
 func makeClientAndContext(builder builderOptions) (*dynamodb.Client, context.Context, context.CancelFunc, error) {
 	ctx, cancelFunc := context.WithCancel(context.Background())
-	client := builder.client
-	if client == nil {
-		var config aws.Config
-		if builder.awsConfig != nil {
-			config = *builder.awsConfig
-		} else {
-			var err error
-			config, err = awsconfig.LoadDefaultConfig(context.Background())
-			if err != nil {
-				cancelFunc()
-				return nil, nil, nil, err
-			}
-		}
-		var optFns []func(*dynamodb.Options)
-		if builder.clientOptions != nil {
-			optFns = append(optFns, func(o *dynamodb.Options) {
-				*o = mergeDynamoDBOptions(*o, *builder.clientOptions)
-			})
+	if builder.client == nil && builder.sharedClient != nil {
+		client, err := builder.sharedClient.acquire()
+		if err != nil {
+			cancelFunc()
+			return nil, nil, nil, err
 		}
-		optFns = append(optFns, builder.clientOptFns...)
-		client = dynamodb.NewFromConfig(config, optFns...)
+		var releaseOnce sync.Once
+		return client, ctx, func() {
+			cancelFunc()
+			releaseOnce.Do(builder.sharedClient.release)
+		}, nil
+	}
+	client, err := makeClient(builder)
+	if err != nil {
+		cancelFunc()
+		return nil, nil, nil, err
 	}
 	return client, ctx, cancelFunc, nil
 }
 
+func makeClient(builder builderOptions) (*dynamodb.Client, error) {
+	if builder.client != nil {
+		return builder.client, nil
+	}
+	var config aws.Config
+	if builder.awsConfig != nil {
+		config = *builder.awsConfig
+	} else {
+		var err error
+		config, err = awsconfig.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+	var optFns []func(*dynamodb.Options)
+	if builder.clientOptions != nil {
+		optFns = append(optFns, func(o *dynamodb.Options) {
+			*o = mergeDynamoDBOptions(*o, *builder.clientOptions)
+		})
+	}
+	optFns = append(optFns, builder.clientOptFns...)
+	return dynamodb.NewFromConfig(config, optFns...), nil
+}
+
 func mergeDynamoDBOptions(target, source dynamodb.Options) dynamodb.Options {
 	// This awkward logic is necessary due to a design detail of the AWS SDK:
 	// - Most applications will want to use the "default configuration" behavior, where AWS gets
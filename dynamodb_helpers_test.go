@@ -0,0 +1,82 @@
+package lddynamodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunConcurrently(t *testing.T) {
+	t.Run("calls function for every index", func(t *testing.T) {
+		var lock sync.Mutex
+		seen := make(map[int]bool)
+		err := runConcurrently(context.Background(), 3, 10, func(ctx context.Context, i int) error {
+			lock.Lock()
+			seen[i] = true
+			lock.Unlock()
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, seen, 10)
+	})
+
+	t.Run("limits concurrency", func(t *testing.T) {
+		var lock sync.Mutex
+		running, maxRunning := 0, 0
+		err := runConcurrently(context.Background(), 3, 20, func(ctx context.Context, i int) error {
+			lock.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			lock.Unlock()
+			time.Sleep(time.Millisecond)
+			lock.Lock()
+			running--
+			lock.Unlock()
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, maxRunning, 3)
+	})
+
+	t.Run("concurrency less than 1 means 1", func(t *testing.T) {
+		var order []int
+		err := runConcurrently(context.Background(), 0, 5, func(ctx context.Context, i int) error {
+			order = append(order, i) // no lock needed if calls are sequential
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+	})
+
+	t.Run("returns first error and stops starting calls", func(t *testing.T) {
+		fail := errors.New("sorry")
+		var lock sync.Mutex
+		calls := 0
+		err := runConcurrently(context.Background(), 1, 10, func(ctx context.Context, i int) error {
+			lock.Lock()
+			calls++
+			lock.Unlock()
+			if i == 2 {
+				return fail
+			}
+			return nil
+		})
+		assert.Equal(t, fail, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("returns error if context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := runConcurrently(ctx, 2, 10, func(ctx context.Context, i int) error {
+			return nil
+		})
+		assert.Equal(t, context.Canceled, err)
+	})
+}
@@ -8,31 +8,41 @@ package lddynamodb
 // Implementation notes:
 //
 // - Feature flags, segments, and any other kind of entity the LaunchDarkly client may wish
-// to store, are all put in the same table. The only two required attributes are "key" (which
-// is present in all storeable entities) and "namespace" (a parameter from the client that is
-// used to disambiguate between flags and segments).
+// to store, are all put in the same table unless the application has configured a separate table
+// for some data kinds. The only two required attributes are "key" (which is present in all
+// storeable entities) and "namespace" (a parameter from the client that is used to disambiguate
+// between flags and segments). The special "$inited" item always goes in the primary table.
 //
 // - Because of DynamoDB's restrictions on attribute values (e.g. empty strings are not
 // allowed), the standard DynamoDB marshaling mechanism with one attribute per object property
 // is not used. Instead, the entire object is serialized to JSON and stored in a single
 // attribute, "item". The "version" property is also stored as a separate attribute since it
-// is used for updates.
+// is used for updates. An application can substitute a different ItemCodec to change how the
+// content is stored (for instance, compressed); in that case the name of the codec is stored in
+// a "codec" attribute, so that items written with different codecs can coexist in a table.
 //
 // - Since DynamoDB doesn't have transactions, the Init method - which replaces the entire data
 // store - is not atomic, so there can be a race condition if another process is adding new data
 // via Upsert. To minimize this, we don't delete all the data at the start; instead, we update
-// the items we've received, and then delete all other items. That could potentially result in
-// deleting new data from another process, but that would be the case anyway if the Init
-// happened to execute later than the Upsert; we are relying on the fact that normally the
-// process that did the Init will also receive the new data shortly and do its own Upsert.
+// the items we've received, and then delete all other items. Each of those deletes is conditional
+// on the item still having the version we saw when we read the existing keys, so if another
+// process upserts a newer version of the item while Init is running, the newer item is kept.
+// Because Init is not atomic, it also records when it starts and finishes writing (see
+// dynamodb_init_run.go), so that an Init that was interrupted partway through can be detected.
 //
 // - DynamoDB has a maximum item size of 400KB. Since each feature flag or user segment is
 // stored as a single item, this mechanism will not work for extremely large flags or segments.
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
 	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
@@ -49,6 +59,9 @@ const (
 	versionAttribute  = "version"
 	itemJSONAttribute = "item"
 
+	// Attribute of the "$inited" item that holds the hash of the data set; see initDataHash
+	initedDataHashAttr = "dataHash"
+
 	// We won't try to store items whose total size exceeds this. The DynamoDB documentation says
 	// only "400KB", which probably means 400*1024, but to avoid any chance of trying to store a
 	// too-large item we are rounding it down.
@@ -56,134 +69,313 @@ const (
 )
 
 type namespaceAndKey struct {
+	table     string
 	namespace string
 	key       string
 }
 
 // Internal type for our DynamoDB implementation of the ld.DataStore interface.
 type dynamoDBDataStore struct {
-	client         *dynamodb.Client
-	context        context.Context
-	cancelContext  func()
-	table          string
-	prefix         string
-	loggers        ldlog.Loggers
-	testUpdateHook func() // Used only by unit tests - see updateWithVersioning
+	client                  *dynamodb.Client
+	context                 context.Context
+	cancelContext           func()
+	table                   string
+	kindTables              map[string]string
+	prefix                  string
+	codecs                  itemCodecs
+	readLimiter             *capacityLimiter
+	writeLimiter            *capacityLimiter
+	initConcurrency         int
+	initProgressHandler     func(InitProgress)
+	initProgressLogInterval time.Duration
+	requireCompleteInit     bool
+	skipUnchangedInit       bool
+	environment             string
+	allowEnvironmentChange  bool
+	environmentRecheck      time.Duration
+	versionRegressionPolicy VersionRegressionPolicy
+	readOnly                bool
+	readOnlyErrors          bool
+	writerID                string
+	lease                   *writerLease
+	tracer                  *storeTracer
+	metrics                 *storeMetrics
+	capacity                *capacityAccountant
+	apiOptions              []func(*dynamodb.Options)
+	snapshot                *fallbackSnapshot
+	packedSnapshot          bool
+	loggers                 ldlog.Loggers
+	testUpdateHook          func() // Used only by unit tests - see updateWithVersioning
+
+	lock                    sync.Mutex
+	reportedIncompleteRunID string
+	checkedIncompleteInit   bool
+	tableEnvironment        string
+	tableEnvironmentSeenAt  time.Time
+	packedSnapshotID        string
+	packedSnapshotKinds     map[string][]ldstoretypes.KeyedSerializedItemDescriptor
 }
 
-func newDynamoDBDataStoreImpl(builder builderOptions, loggers ldlog.Loggers) (*dynamoDBDataStore, error) {
+func newDynamoDBDataStoreImpl(
+	builder builderOptions,
+	environment string,
+	loggers ldlog.Loggers,
+) (*dynamoDBDataStore, error) {
 	if builder.table == "" {
 		return nil, errors.New("table name is required")
 	}
+	if builder.packedSnapshot && !makeItemCodecs(builder.codec, builder.decodeCodecs).onlyDefault() {
+		// The snapshot holds the serialized items as they are, so it would bypass encryption or signing
+		return nil, errors.New("PackedSnapshot cannot be used with a non-default Codec")
+	}
 
 	client, context, cancelContext, err := makeClientAndContext(builder)
 	if err != nil {
 		return nil, err
 	}
 	store := &dynamoDBDataStore{
-		client:        client,
-		context:       context,
-		cancelContext: cancelContext,
-		table:         builder.table,
-		prefix:        builder.prefix,
-		loggers:       loggers, // copied by value so we can modify it
+		client:                  client,
+		context:                 context,
+		cancelContext:           cancelContext,
+		table:                   builder.table,
+		kindTables:              builder.kindTables,
+		prefix:                  builder.prefix,
+		codecs:                  makeItemCodecs(builder.codec, builder.decodeCodecs),
+		readLimiter:             newCapacityLimiter(builder.readCapacityLimit, builder.readCapacityBurst),
+		writeLimiter:            newCapacityLimiter(builder.writeCapacityLimit, builder.writeCapacityBurst),
+		initConcurrency:         builder.initConcurrency,
+		initProgressHandler:     builder.initProgressHandler,
+		initProgressLogInterval: builder.initProgressLogInterval,
+		requireCompleteInit:     builder.requireCompleteInit,
+		skipUnchangedInit:       builder.skipUnchangedInit,
+		environment:             environment,
+		allowEnvironmentChange:  builder.allowEnvironmentChange,
+		environmentRecheck:      environmentRecheckInterval,
+		versionRegressionPolicy: builder.versionRegressionPolicy,
+		readOnly:                builder.readOnly,
+		readOnlyErrors:          builder.readOnlyErrors,
+		writerID:                builder.writerID,
+		packedSnapshot:          builder.packedSnapshot,
+		loggers:                 loggers, // copied by value so we can modify it
 	}
 	store.loggers.SetPrefix("DynamoDBDataStore:")
 	store.loggers.Infof(`Using DynamoDB table %s`, store.table)
+	for kindName, table := range store.kindTables {
+		store.loggers.Infof(`Using DynamoDB table %s for %s`, table, kindName)
+	}
+	if store.writerID == "" {
+		store.writerID = defaultWriterID()
+	}
+	store.tracer = newStoreTracer(builder.tracer, "DynamoDBDataStore.", store.table, store.prefix)
+	if store.tracer != nil {
+		store.apiOptions = append(store.apiOptions, addTracingMiddleware)
+	}
+	store.metrics = newStoreMetrics(builder.metrics, store.table, store.prefix)
+	if store.metrics != nil {
+		store.apiOptions = append(store.apiOptions, store.metrics.addMiddleware)
+	}
+	store.capacity = newCapacityAccountant(builder.capacityAccounting, store.prefix)
+	if store.capacity != nil {
+		store.apiOptions = append(store.apiOptions, store.capacity.addMiddleware)
+		go store.capacity.logPeriodically(store.context, builder.capacityLogInterval, store.loggers)
+	}
+	slowLogger := newSlowOperationLogger(builder.slowOperationThreshold, store.table, store.loggers)
+	if slowLogger != nil {
+		store.apiOptions = append(store.apiOptions, slowLogger.addMiddleware)
+	}
+	store.snapshot = newFallbackSnapshot(builder.fallbackSnapshotFile, store.loggers)
+	if builder.writerLeaseDuration > 0 && !store.readOnly {
+		store.lease = newWriterLease(store, store.writerID, builder.writerLeaseDuration)
+	}
 
 	return store, nil
 }
 
 func (store *dynamoDBDataStore) Init(allData []ldstoretypes.SerializedCollection) error {
-	// Start by reading the existing keys; we will later delete any of these that weren't in allData.
-	unusedOldKeys, err := store.readExistingKeys(allData)
-	if err != nil {
-		return fmt.Errorf("failed to get existing items prior to Init: %s", err)
-	}
-
-	requests := make([]types.WriteRequest, 0)
+	ctx, span := store.tracer.start(store.context, "Init", "")
 	numItems := 0
-
-	// Insert or update every provided item
 	for _, coll := range allData {
-		for _, item := range coll.Items {
-			av := store.encodeItem(coll.Kind, item.Key, item.Item)
-			if !store.checkSizeLimit(av) {
-				continue
-			}
-			requests = append(requests, types.WriteRequest{
-				PutRequest: &types.PutRequest{Item: av},
-			})
-			nk := namespaceAndKey{namespace: store.namespaceForKind(coll.Kind), key: item.Key}
-			unusedOldKeys[nk] = false
-			numItems++
-		}
+		numItems += len(coll.Items)
 	}
+	span.setKeyCount(numItems)
+	err := classifyError(store.context, store.initialize(ctx, allData))
+	span.end(err)
+	return err
+}
 
-	// Now delete any previously existing items whose keys were not in the current data
-	initedKey := store.initedKey()
-	for k, v := range unusedOldKeys {
-		if v && k.namespace != initedKey {
-			delKey := map[string]types.AttributeValue{
-				tablePartitionKey: attrValueOfString(k.namespace),
-				tableSortKey:      attrValueOfString(k.key),
-			}
-			requests = append(requests, types.WriteRequest{
-				DeleteRequest: &types.DeleteRequest{Key: delKey},
-			})
+func (store *dynamoDBDataStore) initialize(ctx context.Context, allData []ldstoretypes.SerializedCollection) error {
+	if store.readOnly {
+		if store.readOnlyErrors {
+			return fmt.Errorf("failed to initialize table %q: %w", store.table, ErrReadOnly)
 		}
+		store.loggers.Warn("Not initializing the store, because it is read-only")
+		return nil
+	}
+	if !store.isWriter() {
+		store.loggers.Info("Not initializing the store, because another instance holds the writer lease")
+		return nil
 	}
 
-	// Now set the special key that we check in InitializedInternal()
-	initedItem := map[string]types.AttributeValue{
-		tablePartitionKey: attrValueOfString(initedKey),
-		tableSortKey:      attrValueOfString(initedKey),
+	progress := startInitProgress(store.initProgressHandler, store.initProgressLogInterval, store.loggers)
+	defer progress.finish()
+
+	work, err := store.prepareInit(ctx, allData, progress)
+	if err != nil {
+		return err
+	}
+	if work.plan.Unchanged {
+		store.loggers.Infof("Not initializing table %q, because it already contains the same data", store.table)
+		store.lease.initialized()
+		return nil
+	}
+	if work.environmentChanged {
+		store.loggers.Warnf("Table %q was initialized by a different LaunchDarkly environment; replacing its"+
+			" data because AllowEnvironmentChange is set", store.table)
+	}
+	for _, item := range work.plan.TooLarge {
+		store.logItemTooLarge(store.prefixedNamespace(item.Kind), item.Key)
+		store.metrics.itemsTooLarge(store.tableForKindName(item.Kind), "BatchWriteItem", 1)
+	}
+	store.logVersionRegressions(work.plan.Skip)
+	if len(work.plan.Skip) > 0 && store.versionRegressionPolicy == VersionRegressionRefuse {
+		return versionRegressionError(len(work.plan.Skip))
 	}
-	requests = append(requests, types.WriteRequest{
-		PutRequest: &types.PutRequest{Item: initedItem},
-	})
 
-	if err := batchWriteRequests(store.context, store.client, store.table, requests); err != nil {
+	// Record that we are about to start changing data, so that if we don't finish, later readers can
+	// tell that the table may contain a mixture of old and new data.
+	store.checkForIncompleteInit(ctx)
+	runID := newInitRunID()
+	if err := store.startInitRun(ctx, runID); err != nil {
+		return fmt.Errorf("failed to record start of Init: %w", err) // COVERAGE: can't cause this in unit tests
+	}
+	if store.packedSnapshot {
+		if err := store.beginPackedSnapshot(ctx, runID); err != nil {
+			// COVERAGE: can't cause this in unit tests
+			return fmt.Errorf("failed to record start of packed snapshot: %w", err)
+		}
+	}
+
+	progress.setPhase(InitPhaseWriting, work.numWrites())
+	if err := store.writeBatches(ctx, work.requestsByTable, progress); err != nil {
 		// COVERAGE: can't cause an error here in unit tests because we only get this far if the
 		// DynamoDB client is successful on the initial query
-		return fmt.Errorf("failed to write %d items(s) in batches: %s", len(requests), err)
+		return err
 	}
 
-	store.loggers.Infof("Initialized table %q with %d item(s)", store.table, numItems)
+	// Now delete any previously existing items whose keys were not in the current data
+	initedKey := store.initedKey()
+	progress.setPhase(InitPhaseDeleting, len(work.deletes))
+	if err := store.deleteUnusedItems(ctx, work.deletes, progress); err != nil {
+		return err // COVERAGE: see above
+	}
+
+	// Now set the special key that we check in InitializedInternal(). This is done only after all
+	// of the data has been written, so that the store is not reported as initialized prematurely.
+	progress.setPhase(InitPhaseMarkingInited, 1)
+	initedItem := store.initInfoAttributes(work.itemCounts)
+	initedItem[tablePartitionKey] = attrValueOfString(initedKey)
+	initedItem[tableSortKey] = attrValueOfString(initedKey)
+	if work.dataHash != "" {
+		initedItem[initedDataHashAttr] = attrValueOfString(work.dataHash)
+	}
+	if store.environment != "" {
+		initedItem[initedEnvironmentAttr] = attrValueOfString(store.environment)
+	}
+	if err := store.writeLimiter.wait(ctx, writeCapacityUnits(itemSize(initedItem))); err != nil {
+		return err // COVERAGE: can't cause this in unit tests
+	}
+	if err := store.checkStillWriter(); err != nil {
+		return fmt.Errorf("failed to mark table %q as initialized: %w", store.table, err)
+	}
+	if _, err := store.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(store.table),
+		Item:      initedItem,
+	}, store.apiOptions...); err != nil {
+		// COVERAGE: can't cause an error here in unit tests, see above
+		return fmt.Errorf("failed to mark table %q as initialized: %w", store.table, err)
+	}
+	store.rememberTableEnvironment(store.environment)
+	if err := store.completeInitRun(ctx, runID); err != nil {
+		return fmt.Errorf("failed to record completion of Init: %w", err) // COVERAGE: can't cause this in unit tests
+	}
+	progress.advance(1)
+
+	store.lease.initialized()
+	store.loggers.Infof("Initialized table %q with %d item(s)", store.table, work.numWrites())
+
+	if store.packedSnapshot {
+		// The data has been stored, so if the snapshot can't be written, readers just won't use it.
+		if err := store.writePackedSnapshot(ctx, runID, allData, work); err != nil {
+			store.loggers.Warnf("Unable to write packed snapshot: %s", err) // COVERAGE: can't cause this in unit tests
+		}
+	}
 
 	return nil
 }
 
 func (store *dynamoDBDataStore) IsInitialized() bool {
-	result, err := store.client.GetItem(store.context, &dynamodb.GetItemInput{
-		TableName:      aws.String(store.table),
-		ConsistentRead: aws.Bool(true),
-		Key: map[string]types.AttributeValue{
-			tablePartitionKey: attrValueOfString(store.initedKey()),
-			tableSortKey:      attrValueOfString(store.initedKey()),
-		},
-	})
-	return err == nil && len(result.Item) != 0
+	ctx, span := store.tracer.start(store.context, "IsInitialized", "")
+	state, err := store.readInitState(ctx)
+	span.end(err)
+	if err != nil {
+		// If we can't reach DynamoDB but have a fallback snapshot, Get and GetAll will return data from
+		// it, so the SDK should treat the store as initialized.
+		return canUseFallbackSnapshot(err) && store.snapshot.hasData()
+	}
+	store.reportIncompleteInit(state)
+	if state.incomplete() && store.requireCompleteInit {
+		return false
+	}
+	return state.inited
 }
 
 func (store *dynamoDBDataStore) GetAll(
 	kind ldstoretypes.DataKind,
 ) ([]ldstoretypes.KeyedSerializedItemDescriptor, error) {
+	ctx, span := store.tracer.start(store.context, "GetAll", kind.GetName())
+	items, err := store.getAll(ctx, kind)
+	err = classifyError(store.context, err)
+	span.setKeyCount(len(items))
+	span.end(err)
+	return items, err
+}
+
+func (store *dynamoDBDataStore) getAll(
+	ctx context.Context,
+	kind ldstoretypes.DataKind,
+) ([]ldstoretypes.KeyedSerializedItemDescriptor, error) {
+	if store.packedSnapshot {
+		if items, ok := store.readPackedSnapshot(ctx, kind); ok {
+			store.snapshot.save(kind, items)
+			return items, nil
+		}
+	}
 	var results []ldstoretypes.KeyedSerializedItemDescriptor
 	for paginator := dynamodb.NewQueryPaginator(store.client, store.makeQueryForKind(kind)); paginator.HasMorePages(); {
-		out, err := paginator.NextPage(store.context)
+		if !store.readLimiter.tryTake(1) {
+			return nil, fmt.Errorf("failed to get all %s: %w", kind, errReadCapacityExceeded)
+		}
+		out, err := paginator.NextPage(ctx, store.apiOptions...)
 		if err != nil {
+			if items, ok := store.snapshot.getAll(kind, err); ok {
+				return items, nil
+			}
 			return nil, err
 		}
+		store.readLimiter.charge(queryReadCapacityUnits(out.Items) - 1)
 		for _, item := range out.Items {
-			if key, serializedItemDesc, ok := store.decodeItem(item); ok {
-				results = append(results, ldstoretypes.KeyedSerializedItemDescriptor{
-					Key:  key,
-					Item: serializedItemDesc,
-				})
+			key, serializedItemDesc, err := store.decodeItem(item)
+			if err != nil {
+				store.loggers.Errorf("Skipping invalid data for %s key %s: %s", kind, key, err)
+				continue
 			}
+			results = append(results, ldstoretypes.KeyedSerializedItemDescriptor{
+				Key:  key,
+				Item: serializedItemDesc,
+			})
 		}
 	}
+	store.snapshot.save(kind, results)
 	return results, nil
 }
 
@@ -191,31 +383,54 @@ func (store *dynamoDBDataStore) Get(
 	kind ldstoretypes.DataKind,
 	key string,
 ) (ldstoretypes.SerializedItemDescriptor, error) {
-	result, err := store.client.GetItem(store.context, &dynamodb.GetItemInput{
-		TableName:      aws.String(store.table),
+	ctx, span := store.tracer.start(store.context, "Get", kind.GetName())
+	span.setKeyCount(1)
+	item, err := store.get(ctx, kind, key)
+	err = classifyError(store.context, err)
+	span.end(err)
+	return item, err
+}
+
+func (store *dynamoDBDataStore) get(
+	ctx context.Context,
+	kind ldstoretypes.DataKind,
+	key string,
+) (ldstoretypes.SerializedItemDescriptor, error) {
+	if !store.readLimiter.tryTake(1) {
+		return ldstoretypes.SerializedItemDescriptor{}.NotFound(),
+			fmt.Errorf("failed to get %s key %s: %w", kind, key, errReadCapacityExceeded)
+	}
+	result, err := store.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(store.tableForKind(kind)),
 		ConsistentRead: aws.Bool(true),
 		Key: map[string]types.AttributeValue{
 			tablePartitionKey: attrValueOfString(store.namespaceForKind(kind)),
 			tableSortKey:      attrValueOfString(key),
 		},
-	})
+	}, store.apiOptions...)
 	if err != nil {
+		if item, ok := store.snapshot.get(kind, key, err); ok {
+			return item, nil
+		}
 		return ldstoretypes.SerializedItemDescriptor{}.NotFound(),
-			fmt.Errorf("failed to get %s key %s: %s", kind, key, err)
+			fmt.Errorf("failed to get %s key %s: %w", kind, key, err)
 	}
+	store.readLimiter.charge(readCapacityUnits(itemSize(result.Item)) - 1)
+	store.snapshot.markAvailable()
 
 	if len(result.Item) == 0 {
 		if store.loggers.IsDebugEnabled() { // COVERAGE: tests don't verify debug logging
-			store.loggers.Debugf("Item not found (key=%s)", key)
+			store.loggers.Debugf("Item not found (namespace=%s key=%s)", kind, key)
 		}
 		return ldstoretypes.SerializedItemDescriptor{}.NotFound(), nil
 	}
 
-	if _, serializedItemDesc, ok := store.decodeItem(result.Item); ok {
-		return serializedItemDesc, nil
+	_, serializedItemDesc, err := store.decodeItem(result.Item)
+	if err != nil {
+		return ldstoretypes.SerializedItemDescriptor{}.NotFound(),
+			fmt.Errorf("invalid data for %s key %s: %w", kind, key, err)
 	}
-	return ldstoretypes.SerializedItemDescriptor{}.NotFound(), // COVERAGE: can't cause this in unit tests
-		fmt.Errorf("invalid data for %s key %s: %s", kind, key, err)
+	return serializedItemDesc, nil
 }
 
 func (store *dynamoDBDataStore) Upsert(
@@ -223,17 +438,73 @@ func (store *dynamoDBDataStore) Upsert(
 	key string,
 	newItem ldstoretypes.SerializedItemDescriptor,
 ) (bool, error) {
-	av := store.encodeItem(kind, key, newItem)
-	if !store.checkSizeLimit(av) {
+	ctx, span := store.tracer.start(store.context, "Upsert", kind.GetName())
+	span.setKeyCount(1)
+	updated, err := store.upsert(ctx, kind, key, newItem)
+	err = classifyError(store.context, err)
+	span.endUpdate(err, updated)
+	return updated, err
+}
+
+func (store *dynamoDBDataStore) upsert(
+	ctx context.Context,
+	kind ldstoretypes.DataKind,
+	key string,
+	newItem ldstoretypes.SerializedItemDescriptor,
+) (bool, error) {
+	if store.readOnly {
+		if store.readOnlyErrors {
+			return false, fmt.Errorf("failed to put %s key %s: %w", kind, key, ErrReadOnly)
+		}
+		if store.loggers.IsDebugEnabled() { // COVERAGE: tests don't verify debug logging
+			store.loggers.Debugf("Not updating item because the store is read-only (namespace=%s key=%s)", kind, key)
+		}
+		return false, nil
+	}
+
+	av, err := store.encodeItem(kind, key, newItem)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode %s key %s: %w", kind, key, err)
+	}
+	if !store.checkSizeLimit(av, store.tableForKind(kind), "PutItem") {
 		return false, nil
 	}
 
+	if !store.isWriter() {
+		if store.loggers.IsDebugEnabled() { // COVERAGE: tests don't verify debug logging
+			store.loggers.Debugf("Not updating item because another instance holds the writer lease (namespace=%s key=%s)",
+				kind, key)
+		}
+		return false, nil
+	}
+	if store.lease.mustInit() {
+		return false, fmt.Errorf("failed to put %s key %s: %w", kind, key, errWriterNeedsInit)
+	}
+
+	if err := store.writeLimiter.wait(ctx, writeCapacityUnits(itemSize(av))); err != nil {
+		return false, fmt.Errorf("failed to put %s key %s: %w", kind, key, err)
+	}
+
+	if err := store.checkUpsertEnvironment(ctx); err != nil {
+		return false, fmt.Errorf("failed to put %s key %s: %w", kind, key, err)
+	}
+
+	if err := store.clearInitDataHash(ctx); err != nil {
+		return false, fmt.Errorf("failed to put %s key %s: %w", kind, key, err)
+	}
+
+	if store.packedSnapshot {
+		if err := store.markPackedSnapshotStale(ctx); err != nil {
+			return false, fmt.Errorf("failed to mark packed snapshot as stale before putting %s key %s: %w", kind, key, err)
+		}
+	}
+
 	if store.testUpdateHook != nil {
 		store.testUpdateHook()
 	}
 
-	_, err := store.client.PutItem(store.context, &dynamodb.PutItemInput{
-		TableName: aws.String(store.table),
+	_, err = store.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(store.tableForKind(kind)),
 		Item:      av,
 		ConditionExpression: aws.String(
 			"attribute_not_exists(#namespace) or " +
@@ -248,7 +519,7 @@ func (store *dynamoDBDataStore) Upsert(
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":version": attrValueOfInt(newItem.Version),
 		},
-	})
+	}, store.apiOptions...)
 	if err != nil {
 		var condCheckErr *types.ConditionalCheckFailedException
 		if errors.As(err, &condCheckErr) {
@@ -258,9 +529,8 @@ func (store *dynamoDBDataStore) Upsert(
 			}
 			return false, nil
 		}
-		return false, fmt.Errorf("failed to put %s key %s: %s", kind, key, err)
+		return false, fmt.Errorf("failed to put %s key %s: %w", kind, key, err)
 	}
-
 	return true, nil
 }
 
@@ -268,19 +538,31 @@ func (store *dynamoDBDataStore) IsStoreAvailable() bool {
 	// There doesn't seem to be a specific DynamoDB API for just testing the connection. We will just
 	// do a simple query for the "inited" key, and test whether we get an error ("not found" does not
 	// count as an error).
-	_, err := store.client.GetItem(store.context, &dynamodb.GetItemInput{
-		TableName:      aws.String(store.table),
-		ConsistentRead: aws.Bool(true),
+	out, err := store.client.GetItem(store.context, &dynamodb.GetItemInput{
+		TableName:              aws.String(store.table),
+		ConsistentRead:         aws.Bool(true),
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
 		Key: map[string]types.AttributeValue{
 			tablePartitionKey: attrValueOfString(store.initedKey()),
 			tableSortKey:      attrValueOfString(store.initedKey()),
 		},
-	})
-	return err == nil
+	}, store.apiOptions...)
+	if err != nil {
+		// This is also how the SDK finds out that data from the fallback snapshot, if any, is stale. A
+		// failed request doesn't consume any read capacity, so we don't charge for it.
+		return false
+	}
+	store.readLimiter.charge(consumedReadCapacityUnits(out, readCapacityUnits(itemSize(out.Item))))
+	store.snapshot.markAvailable()
+	return true
 }
 
 func (store *dynamoDBDataStore) Close() error {
+	if store.lease != nil {
+		store.lease.close() // this must happen before cancelContext so it can release the lease
+	}
 	store.cancelContext() // stops any pending operations
+	store.snapshot.close()
 	return nil
 }
 
@@ -295,13 +577,41 @@ func (store *dynamoDBDataStore) namespaceForKind(kind ldstoretypes.DataKind) str
 	return store.prefixedNamespace(kind.GetName())
 }
 
+// isWriter returns true if this store may write data: that is, if the writer lease is not enabled, or
+// this store holds the lease.
+func (store *dynamoDBDataStore) isWriter() bool {
+	return store.lease == nil || store.lease.isHolder()
+}
+
+// checkStillWriter is called by Init before each write, so that if the writer lease was lost while
+// Init was running, it stops instead of overwriting data that the new lease holder is writing.
+func (store *dynamoDBDataStore) checkStillWriter() error {
+	if !store.isWriter() {
+		return errLostWriterLease
+	}
+	return nil
+}
+
+// tableForKind returns the table that holds items of the specified kind, which is the primary table
+// unless the application configured a different one.
+func (store *dynamoDBDataStore) tableForKind(kind ldstoretypes.DataKind) string {
+	return store.tableForKindName(kind.GetName())
+}
+
+func (store *dynamoDBDataStore) tableForKindName(kindName string) string {
+	if table, ok := store.kindTables[kindName]; ok {
+		return table
+	}
+	return store.table
+}
+
 func (store *dynamoDBDataStore) initedKey() string {
 	return store.prefixedNamespace("$inited")
 }
 
 func (store *dynamoDBDataStore) makeQueryForKind(kind ldstoretypes.DataKind) *dynamodb.QueryInput {
 	return &dynamodb.QueryInput{
-		TableName:      aws.String(store.table),
+		TableName:      aws.String(store.tableForKind(kind)),
 		ConsistentRead: aws.Bool(true),
 		KeyConditions: map[string]types.Condition{
 			tablePartitionKey: {
@@ -314,71 +624,232 @@ func (store *dynamoDBDataStore) makeQueryForKind(kind ldstoretypes.DataKind) *dy
 	}
 }
 
+// readExistingKeys returns the key and version of every item that is currently in the store for each
+// of the data kinds in newData.
 func (store *dynamoDBDataStore) readExistingKeys(
+	ctx context.Context,
 	newData []ldstoretypes.SerializedCollection,
-) (map[namespaceAndKey]bool, error) {
-	keys := make(map[namespaceAndKey]bool)
-	for _, coll := range newData {
-		kind := coll.Kind
+	progress *initProgressTracker,
+) (map[namespaceAndKey]int, error) {
+	keys := make(map[namespaceAndKey]int)
+	var keysLock sync.Mutex
+	err := runConcurrently(ctx, store.initConcurrency, len(newData), func(ctx context.Context, i int) error {
+		kind := newData[i].Kind
+		table := store.tableForKind(kind)
 		query := store.makeQueryForKind(kind)
-		query.ProjectionExpression = aws.String("#namespace, #key")
+		query.ProjectionExpression = aws.String("#namespace, #key, #version")
+		query.ReturnConsumedCapacity = types.ReturnConsumedCapacityTotal
 		query.ExpressionAttributeNames = map[string]string{
 			"#namespace": tablePartitionKey,
 			"#key":       tableSortKey,
+			"#version":   versionAttribute,
 		}
-		for paginator := dynamodb.NewQueryPaginator(store.client, store.makeQueryForKind(kind)); paginator.HasMorePages(); {
-			out, err := paginator.NextPage(store.context)
+		for paginator := dynamodb.NewQueryPaginator(store.client, query); paginator.HasMorePages(); {
+			if err := store.readLimiter.wait(ctx, 1); err != nil {
+				return err
+			}
+			out, err := paginator.NextPage(ctx, store.apiOptions...)
 			if err != nil {
-				return nil, err
+				return err
 			}
-			for _, i := range out.Items {
-				nk := namespaceAndKey{namespace: attrValueToString(i[tablePartitionKey]),
-					key: attrValueToString(i[tableSortKey])}
-				keys[nk] = true
+			store.readLimiter.charge(consumedReadCapacityUnits(out, queryReadCapacityUnits(out.Items)) - 1)
+			keysLock.Lock()
+			for _, item := range out.Items {
+				nk := namespaceAndKey{table: table, namespace: attrValueToString(item[tablePartitionKey]),
+					key: attrValueToString(item[tableSortKey])}
+				keys[nk] = attrValueToInt(item[versionAttribute])
 			}
+			keysLock.Unlock()
 		}
+		progress.advance(1)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return keys, nil
 }
 
+// initDataHash returns a hash of the table, namespace, key, and version of every item in the data
+// set, along with the name of the codec that would be used to write them, so that SkipUnchangedInit
+// can tell whether the table already contains the same data. The items are sorted first, so the
+// order in which the SDK provides them does not matter.
+func (store *dynamoDBDataStore) initDataHash(allData []ldstoretypes.SerializedCollection) string {
+	var entries []string
+	for _, coll := range allData {
+		table, namespace := store.tableForKind(coll.Kind), store.namespaceForKind(coll.Kind)
+		for _, item := range coll.Items {
+			entries = append(entries, fmt.Sprintf("%s\x00%s\x00%s\x00%d\n", table, namespace, item.Key, item.Item.Version))
+		}
+	}
+	sort.Strings(entries)
+	h := sha256.New()
+	_, _ = h.Write([]byte(store.codecs.writer.Name() + "\n"))
+	for _, e := range entries {
+		_, _ = h.Write([]byte(e))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// clearInitDataHash removes the hash that SkipUnchangedInit recorded for the last Init, because the
+// table is about to be changed by an update. This happens before the update is written, so that if the
+// update succeeds, a later Init can never wrongly conclude that the table still contains the same data.
+func (store *dynamoDBDataStore) clearInitDataHash(ctx context.Context) error {
+	if !store.skipUnchangedInit {
+		return nil
+	}
+	if err := store.writeLimiter.wait(ctx, 1); err != nil {
+		return err // COVERAGE: can't cause this in unit tests
+	}
+	_, err := store.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(store.table),
+		Key: map[string]types.AttributeValue{
+			tablePartitionKey: attrValueOfString(store.initedKey()),
+			tableSortKey:      attrValueOfString(store.initedKey()),
+		},
+		UpdateExpression:         aws.String("REMOVE #hash"),
+		ConditionExpression:      aws.String("attribute_exists(#hash)"),
+		ExpressionAttributeNames: map[string]string{"#hash": initedDataHashAttr},
+	}, store.apiOptions...)
+	var condCheckErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condCheckErr) {
+		return nil // there is no hash to remove
+	}
+	return err
+}
+
 func (store *dynamoDBDataStore) decodeItem(
 	av map[string]types.AttributeValue,
-) (string, ldstoretypes.SerializedItemDescriptor, bool) {
+) (string, ldstoretypes.SerializedItemDescriptor, error) {
 	key := attrValueToString(av[tableSortKey])
-	version := attrValueToInt(av[versionAttribute])
-	itemJSON := attrValueToString(av[itemJSONAttribute])
-	if key != "" {
-		return key, ldstoretypes.SerializedItemDescriptor{
-			Version:        version,
-			SerializedItem: []byte(itemJSON),
-		}, true
-	}
-	return "", ldstoretypes.SerializedItemDescriptor{}, false // COVERAGE: no way to cause this in unit tests
+	if key == "" {
+		return "", ldstoretypes.SerializedItemDescriptor{}, // COVERAGE: no way to cause this in unit tests
+			errors.New("item has no key")
+	}
+	item, err := store.codecs.decode(av)
+	if err != nil {
+		return key, ldstoretypes.SerializedItemDescriptor{}, err
+	}
+	item.Version = attrValueToInt(av[versionAttribute])
+	return key, item, nil
 }
 
 func (store *dynamoDBDataStore) encodeItem(
 	kind ldstoretypes.DataKind,
 	key string,
 	item ldstoretypes.SerializedItemDescriptor,
-) map[string]types.AttributeValue {
-	return map[string]types.AttributeValue{
-		tablePartitionKey: attrValueOfString(store.namespaceForKind(kind)),
-		tableSortKey:      attrValueOfString(key),
-		versionAttribute:  attrValueOfInt(item.Version),
-		itemJSONAttribute: attrValueOfString(string(item.SerializedItem)),
+) (map[string]types.AttributeValue, error) {
+	av, err := store.codecs.encode(item)
+	if err != nil {
+		return nil, err
 	}
+	av[tablePartitionKey] = attrValueOfString(store.namespaceForKind(kind))
+	av[tableSortKey] = attrValueOfString(key)
+	av[versionAttribute] = attrValueOfInt(item.Version)
+	return av, nil
 }
 
-func (store *dynamoDBDataStore) checkSizeLimit(item map[string]types.AttributeValue) bool {
-	// see: https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/CapacityUnitCalculations.html
-	size := 100 // fixed overhead for index data
-	for key, value := range item {
-		size += len(key) + len(attrValueToString(value))
+// writeBatches is like batchWriteRequests, but it can write to several tables, it runs up to
+// initConcurrency batches at once, and it waits for write capacity if there is a limit.
+func (store *dynamoDBDataStore) writeBatches(
+	ctx context.Context,
+	requestsByTable map[string][]types.WriteRequest,
+	progress *initProgressTracker,
+) error {
+	type tableBatch struct {
+		table    string
+		requests []types.WriteRequest
 	}
-	if size <= dynamoDbMaxItemSize {
+	tables := make([]string, 0, len(requestsByTable))
+	for table := range requestsByTable {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	var batches []tableBatch
+	for _, table := range tables {
+		requests := requestsByTable[table]
+		for len(requests) > 0 {
+			batchSize := int(math.Min(float64(len(requests)), batchWriteMaxItems))
+			batches = append(batches, tableBatch{table: table, requests: requests[:batchSize]})
+			requests = requests[batchSize:]
+		}
+	}
+
+	return runConcurrently(ctx, store.initConcurrency, len(batches), func(ctx context.Context, i int) error {
+		batch := batches[i]
+		if err := store.writeLimiter.wait(ctx, writeRequestCapacityUnits(batch.requests)); err != nil {
+			return err // COVERAGE: can't cause this in unit tests
+		}
+		if err := store.checkStillWriter(); err != nil {
+			return err
+		}
+		if err := batchWriteRequests(ctx, store.client, batch.table, batch.requests, store.metrics,
+			store.apiOptions...); err != nil {
+			// COVERAGE: see batchWriteRequests
+			return fmt.Errorf("failed to write %d item(s) in a batch to table %q: %w", len(batch.requests), batch.table, err)
+		}
+		progress.advance(len(batch.requests))
+		return nil
+	})
+}
+
+// deleteUnusedItems deletes each of the specified items, as long as it still has the version that
+// readExistingKeys saw. Items that have been changed since then by another writer are left alone.
+// BatchWriteItem does not support conditions, so each item is deleted with its own request, running
+// up to initConcurrency of them at once.
+func (store *dynamoDBDataStore) deleteUnusedItems(
+	ctx context.Context,
+	versionsByKey map[namespaceAndKey]int,
+	progress *initProgressTracker,
+) error {
+	keys := make([]namespaceAndKey, 0, len(versionsByKey))
+	for k := range versionsByKey {
+		keys = append(keys, k)
+	}
+	return runConcurrently(ctx, store.initConcurrency, len(keys), func(ctx context.Context, i int) error {
+		k := keys[i]
+		version := versionsByKey[k]
+		if err := store.writeLimiter.wait(ctx, 1); err != nil {
+			return err // COVERAGE: can't cause this in unit tests
+		}
+		if err := store.checkStillWriter(); err != nil {
+			return err
+		}
+		_, err := store.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(k.table),
+			Key: map[string]types.AttributeValue{
+				tablePartitionKey: attrValueOfString(k.namespace),
+				tableSortKey:      attrValueOfString(k.key),
+			},
+			ConditionExpression:       aws.String("#version = :version"),
+			ExpressionAttributeNames:  map[string]string{"#version": versionAttribute},
+			ExpressionAttributeValues: map[string]types.AttributeValue{":version": attrValueOfInt(version)},
+		}, store.apiOptions...)
+		if err != nil {
+			var condCheckErr *types.ConditionalCheckFailedException
+			if !errors.As(err, &condCheckErr) {
+				// COVERAGE: can't cause this in unit tests
+				return fmt.Errorf("failed to delete %q in %q from table %q: %w", k.key, k.namespace, k.table, err)
+			}
+			store.loggers.Infof("Not deleting %q in %q, because another writer changed it during Init"+
+				" (expected version %d)", k.key, k.namespace, version)
+		}
+		progress.advance(1)
+		return nil
+	})
+}
+
+// checkSizeLimit returns false, and logs and counts the item as dropped, if it is too large to be
+// written to the table by the specified DynamoDB operation.
+func (store *dynamoDBDataStore) checkSizeLimit(item map[string]types.AttributeValue, table, operation string) bool {
+	if itemSize(item) <= dynamoDbMaxItemSize {
 		return true
 	}
-	store.loggers.Errorf("The item %q in %q was too large to store in DynamoDB and was dropped",
-		attrValueToString(item[tablePartitionKey]), attrValueToString(item[tableSortKey]))
+	store.logItemTooLarge(attrValueToString(item[tablePartitionKey]), attrValueToString(item[tableSortKey]))
+	store.metrics.itemsTooLarge(table, operation, 1)
 	return false
 }
+
+func (store *dynamoDBDataStore) logItemTooLarge(namespace, key string) {
+	store.loggers.Errorf("The item %q in %q was too large to store in DynamoDB and was dropped", namespace, key)
+}
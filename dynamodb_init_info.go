@@ -0,0 +1,84 @@
+package lddynamodb
+
+import (
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldtime"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Attributes of the "$inited" item that describe the most recent Init.
+const (
+	initedTimeAttr           = "initedOn"
+	initedWriterIDAttr       = "writerId"
+	initedLibraryVersionAttr = "libraryVersion"
+	initedItemCountsAttr     = "itemCounts"
+)
+
+// InitInfo describes the most recent time that a data store was initialized with a full data set.
+// See [InitInfoReader].
+//
+// If the table was initialized by an older version of this package that did not record this
+// information, only the fields that it did record are set.
+type InitInfo struct {
+	// Time is when the data set was written. If [StoreBuilder.SkipUnchangedInit] is used, a later
+	// initialization with the same data does not update it.
+	Time time.Time
+	// WriterID identifies the data store instance that wrote the data set; see [StoreBuilder.WriterID].
+	WriterID string
+	// LibraryVersion is the version of this package that the writer was using.
+	LibraryVersion string
+	// ItemCounts is the number of items that were written for each data kind, such as "features" or
+	// "segments".
+	ItemCounts map[string]int
+}
+
+// InitInfoReader is implemented by the data store that is created by [DataStore], for applications
+// that want to check how recently the store was initialized, for instance in a health check.
+type InitInfoReader interface {
+	// InitInfo returns information about the most recent initialization of the store, or nil if it
+	// has never been initialized.
+	InitInfo() (*InitInfo, error)
+}
+
+func (store *dynamoDBDataStore) InitInfo() (*InitInfo, error) {
+	state, err := store.readInitState(store.context)
+	if err != nil {
+		return nil, classifyError(store.context, err)
+	}
+	return state.info, nil
+}
+
+// initInfoAttributes returns the attributes to add to the "$inited" item for an Init that has just
+// written the specified number of items of each kind.
+func (store *dynamoDBDataStore) initInfoAttributes(itemCounts map[string]int) map[string]types.AttributeValue {
+	counts := make(map[string]types.AttributeValue, len(itemCounts))
+	for kind, count := range itemCounts {
+		counts[kind] = attrValueOfInt(count)
+	}
+	return map[string]types.AttributeValue{
+		initedTimeAttr:           attrValueOfUint64(uint64(ldtime.UnixMillisNow())),
+		initedWriterIDAttr:       attrValueOfString(store.writerID),
+		initedLibraryVersionAttr: attrValueOfString(Version),
+		initedItemCountsAttr:     &types.AttributeValueMemberM{Value: counts},
+	}
+}
+
+// initInfoFromItem parses the attributes written by initInfoAttributes.
+func initInfoFromItem(item map[string]types.AttributeValue) *InitInfo {
+	info := &InitInfo{
+		WriterID:       attrValueToString(item[initedWriterIDAttr]),
+		LibraryVersion: attrValueToString(item[initedLibraryVersionAttr]),
+	}
+	if millis := attrValueToUint64(item[initedTimeAttr]); millis != 0 {
+		info.Time = time.UnixMilli(int64(millis))
+	}
+	if counts, ok := item[initedItemCountsAttr].(*types.AttributeValueMemberM); ok {
+		info.ItemCounts = make(map[string]int, len(counts.Value))
+		for kind, count := range counts.Value {
+			info.ItemCounts[kind] = attrValueToInt(count)
+		}
+	}
+	return info
+}
@@ -0,0 +1,46 @@
+package lddynamodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataStoreInitInfo(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+	require.NoError(t, clearTestData(""))
+
+	item := ldstoretypes.SerializedItemDescriptor{Version: 1, SerializedItem: []byte(`{}`)}
+	store, err := baseDataStoreBuilder().WriterID("writer1").Build(subsystems.BasicClientContext{})
+	require.NoError(t, err)
+	defer store.Close()
+	reader := store.(InitInfoReader)
+
+	info, err := reader.InitInfo()
+	require.NoError(t, err)
+	assert.Nil(t, info)
+
+	before := time.Now().Truncate(time.Millisecond)
+	require.NoError(t, store.Init([]ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+			{Key: "flag1", Item: item}, {Key: "flag2", Item: item},
+		}},
+		{Kind: ldstoreimpl.Segments(), Items: nil},
+	}))
+	after := time.Now()
+
+	info, err = reader.InitInfo()
+	require.NoError(t, err)
+	require.NotNil(t, info)
+	assert.Equal(t, "writer1", info.WriterID)
+	assert.Equal(t, Version, info.LibraryVersion)
+	assert.Equal(t, map[string]int{"features": 2, "segments": 0}, info.ItemCounts)
+	assert.False(t, info.Time.Before(before))
+	assert.False(t, info.Time.After(after))
+}
@@ -0,0 +1,170 @@
+package lddynamodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// InitPlanItem describes one item in an [InitPlan].
+type InitPlanItem struct {
+	// Kind is the name of the data kind, such as "features" or "segments".
+	Kind string
+	// Key is the item's key.
+	Key string
+	// Version is the item's version in the data set, or zero if it is not in the data set.
+	Version int
+	// StoredVersion is the item's version in the table, or zero if it is not in the table.
+	StoredVersion int
+}
+
+// InitPlan describes what the data store would change if it were initialized with a data set. See
+// [InitPlanner].
+type InitPlan struct {
+	// Unchanged is true if the store would do nothing, because [StoreBuilder.SkipUnchangedInit] is set
+	// and the table already contains the same data set. In that case, the lists are all empty.
+	Unchanged bool
+	// Put contains the items that would be added because they are not in the table.
+	Put []InitPlanItem
+	// Update contains the items that would replace an existing item in the table.
+	Update []InitPlanItem
+	// Skip contains the items that would not be written because the table has a newer version of them
+	// (see [StoreBuilder.VersionRegressionPolicy]). If the policy is [VersionRegressionRefuse] and
+	// this list is not empty, the store would not change anything and would return an error instead.
+	Skip []InitPlanItem
+	// Delete contains the items that would be deleted because they are not in the data set.
+	Delete []InitPlanItem
+	// TooLarge contains the items that would be dropped because they are too large to store in
+	// DynamoDB.
+	TooLarge []InitPlanItem
+}
+
+// InitPlanner is implemented by the data store that is created by [DataStore], for applications that
+// want to find out what initializing the store with a data set would change, without changing
+// anything.
+type InitPlanner interface {
+	// PlanInit reads the table and returns what Init would do with the specified data set, without
+	// writing anything. It returns an error in the same cases that Init would return one before
+	// writing, such as when the table was initialized by a different LaunchDarkly environment. It does
+	// not take the writer lease into account (see [StoreBuilder.WriterLease]).
+	PlanInit(allData []ldstoretypes.SerializedCollection) (*InitPlan, error)
+}
+
+// initWork is the plan for an Init, along with everything that is needed to carry it out.
+type initWork struct {
+	plan               InitPlan
+	requestsByTable    map[string][]types.WriteRequest
+	deletes            map[namespaceAndKey]int
+	itemCounts         map[string]int
+	dataHash           string
+	environmentChanged bool
+}
+
+func (store *dynamoDBDataStore) PlanInit(allData []ldstoretypes.SerializedCollection) (*InitPlan, error) {
+	progress := startInitProgress(nil, 0, store.loggers)
+	defer progress.finish()
+	work, err := store.prepareInit(store.context, allData, progress)
+	if err != nil {
+		return nil, err
+	}
+	return &work.plan, nil
+}
+
+// prepareInit does all of the reading and encoding for Init, and decides what it will write.
+func (store *dynamoDBDataStore) prepareInit(
+	ctx context.Context,
+	allData []ldstoretypes.SerializedCollection,
+	progress *initProgressTracker,
+) (*initWork, error) {
+	work := &initWork{
+		requestsByTable: make(map[string][]types.WriteRequest),
+		itemCounts:      make(map[string]int),
+	}
+
+	if store.skipUnchangedInit || store.environment != "" {
+		state, err := store.readInitState(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state of table prior to Init: %w", err)
+		}
+		store.reportIncompleteInit(state)
+		if err := store.checkEnvironment(state.environment); err != nil {
+			return nil, err
+		}
+		work.environmentChanged = store.environmentDiffers(state.environment)
+		if store.skipUnchangedInit {
+			work.dataHash = store.initDataHash(allData)
+			if state.inited && !state.incomplete() && state.dataHash == work.dataHash {
+				work.plan.Unchanged = true
+				return work, nil
+			}
+		}
+	}
+
+	// Start by reading the existing keys; we will later delete any of these that weren't in allData.
+	progress.setPhase(InitPhaseReadingExistingKeys, len(allData))
+	unusedOldKeys, err := store.readExistingKeys(ctx, allData, progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get existing items prior to Init: %w", err)
+	}
+
+	// Insert or update every provided item, unless the store has a newer version of it and the
+	// application has asked us to guard against that
+	kindNamesByNamespace := make(map[string]string)
+	for _, coll := range allData {
+		kindName, table, namespace := coll.Kind.GetName(), store.tableForKind(coll.Kind), store.namespaceForKind(coll.Kind)
+		kindNamesByNamespace[namespace] = kindName
+		work.itemCounts[kindName] = 0
+		for _, item := range coll.Items {
+			nk := namespaceAndKey{table: table, namespace: namespace, key: item.Key}
+			planItem := InitPlanItem{Kind: kindName, Key: item.Key, Version: item.Item.Version}
+			storedVersion, stored := unusedOldKeys[nk]
+			if stored {
+				planItem.StoredVersion = storedVersion
+				if store.versionRegressionPolicy != VersionRegressionAllow && storedVersion > item.Item.Version {
+					work.plan.Skip = append(work.plan.Skip, planItem)
+					delete(unusedOldKeys, nk)
+					continue
+				}
+			}
+			av, err := store.encodeItem(coll.Kind, item.Key, item.Item)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s key %s: %w", coll.Kind, item.Key, err)
+			}
+			if itemSize(av) > dynamoDbMaxItemSize {
+				work.plan.TooLarge = append(work.plan.TooLarge, planItem)
+				continue
+			}
+			work.requestsByTable[table] = append(work.requestsByTable[table], types.WriteRequest{
+				PutRequest: &types.PutRequest{Item: av},
+			})
+			delete(unusedOldKeys, nk)
+			work.itemCounts[kindName]++
+			if stored {
+				work.plan.Update = append(work.plan.Update, planItem)
+			} else {
+				work.plan.Put = append(work.plan.Put, planItem)
+			}
+		}
+	}
+
+	work.deletes = unusedOldKeys
+	for nk, storedVersion := range unusedOldKeys {
+		work.plan.Delete = append(work.plan.Delete, InitPlanItem{
+			Kind: kindNamesByNamespace[nk.namespace], Key: nk.key, StoredVersion: storedVersion,
+		})
+	}
+	sort.Slice(work.plan.Delete, func(i, j int) bool {
+		a, b := work.plan.Delete[i], work.plan.Delete[j]
+		return a.Kind < b.Kind || (a.Kind == b.Kind && a.Key < b.Key)
+	})
+	return work, nil
+}
+
+// numWrites returns the number of items that the plan would write.
+func (w *initWork) numWrites() int {
+	return len(w.plan.Put) + len(w.plan.Update)
+}
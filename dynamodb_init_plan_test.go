@@ -0,0 +1,85 @@
+package lddynamodb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataStorePlanInit(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	item := func(key string, version int) ldstoretypes.KeyedSerializedItemDescriptor {
+		return ldstoretypes.KeyedSerializedItemDescriptor{Key: key,
+			Item: ldstoretypes.SerializedItemDescriptor{Version: version, SerializedItem: []byte(`{}`)}}
+	}
+	hugeItem := ldstoretypes.KeyedSerializedItemDescriptor{Key: "huge", Item: ldstoretypes.SerializedItemDescriptor{
+		Version: 1, SerializedItem: []byte(`{"value":"` + strings.Repeat("x", dynamoDbMaxItemSize) + `"}`),
+	}}
+	storedData := []ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+			item("flag1", 1), item("flag2", 5), item("flag3", 1)}},
+		{Kind: ldstoreimpl.Segments(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{item("seg1", 1)}},
+	}
+	newData := []ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+			item("flag1", 2), item("flag2", 4), item("flag4", 1), hugeItem}},
+		{Kind: ldstoreimpl.Segments(), Items: nil},
+	}
+
+	makeStore := func(t *testing.T,
+		builder *StoreBuilder[subsystems.PersistentDataStore]) subsystems.PersistentDataStore {
+		store, err := builder.Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	}
+
+	t.Run("plan lists changes without making them", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store := makeStore(t, baseDataStoreBuilder().VersionRegressionPolicy(VersionRegressionSkip))
+		require.NoError(t, store.Init(storedData))
+
+		plan, err := store.(InitPlanner).PlanInit(newData)
+		require.NoError(t, err)
+		assert.Equal(t, InitPlan{
+			Put:    []InitPlanItem{{Kind: "features", Key: "flag4", Version: 1}},
+			Update: []InitPlanItem{{Kind: "features", Key: "flag1", Version: 2, StoredVersion: 1}},
+			Skip:   []InitPlanItem{{Kind: "features", Key: "flag2", Version: 4, StoredVersion: 5}},
+			Delete: []InitPlanItem{
+				{Kind: "features", Key: "flag3", StoredVersion: 1},
+				{Kind: "segments", Key: "seg1", StoredVersion: 1},
+			},
+			TooLarge: []InitPlanItem{{Kind: "features", Key: "huge", Version: 1}},
+		}, *plan)
+
+		flags, err := store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.Equal(t, storedData[0].Items, flags)
+	})
+
+	t.Run("plan reports unchanged data", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store := makeStore(t, baseDataStoreBuilder().SkipUnchangedInit())
+		require.NoError(t, store.Init(storedData))
+
+		plan, err := store.(InitPlanner).PlanInit(storedData)
+		require.NoError(t, err)
+		assert.Equal(t, InitPlan{Unchanged: true}, *plan)
+	})
+
+	t.Run("plan returns the same error as Init", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		require.NoError(t, makeStore(t, baseDataStoreBuilder().EnvironmentID("env1")).Init(storedData))
+
+		_, err := makeStore(t, baseDataStoreBuilder().EnvironmentID("env2")).(InitPlanner).PlanInit(newData)
+		assert.True(t, errors.Is(err, ErrEnvironmentMismatch))
+	})
+}
@@ -0,0 +1,120 @@
+package lddynamodb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+)
+
+// DefaultInitProgressLogInterval is the default value for [StoreBuilder.InitProgressLogInterval].
+const DefaultInitProgressLogInterval = 10 * time.Second
+
+// InitPhase identifies a stage of initializing the data store with a full data set.
+type InitPhase string
+
+const (
+	// InitPhaseReadingExistingKeys is the stage of querying the keys that are already in the store,
+	// so that items which are no longer in the data set can be deleted later. Progress is counted in
+	// data kinds.
+	InitPhaseReadingExistingKeys InitPhase = "reading existing keys"
+
+	// InitPhaseWriting is the stage of writing every item in the data set. Progress is counted in
+	// items.
+	InitPhaseWriting InitPhase = "writing"
+
+	// InitPhaseDeleting is the stage of deleting items that are no longer in the data set. Progress
+	// is counted in items.
+	InitPhaseDeleting InitPhase = "deleting"
+
+	// InitPhaseMarkingInited is the final stage of writing the marker that indicates the store has
+	// been initialized.
+	InitPhaseMarkingInited InitPhase = "marking inited"
+)
+
+// InitProgress describes how far the data store has gotten in initializing itself with a full data
+// set. See [StoreBuilder.InitProgressHandler].
+type InitProgress struct {
+	// Phase is the current stage of initialization.
+	Phase InitPhase
+	// Done is how many units of work in the current phase have been completed.
+	Done int
+	// Total is how many units of work there are in the current phase.
+	Total int
+	// Elapsed is the time since initialization started.
+	Elapsed time.Duration
+}
+
+// initProgressTracker keeps track of the progress of one call to Init, reporting it to the
+// application's handler whenever it changes and logging it periodically.
+type initProgressTracker struct {
+	lock     sync.Mutex
+	handler  func(InitProgress)
+	loggers  ldlog.Loggers
+	start    time.Time
+	current  InitProgress
+	stopChan chan struct{}
+}
+
+func startInitProgress(handler func(InitProgress), logInterval time.Duration, loggers ldlog.Loggers) *initProgressTracker {
+	t := &initProgressTracker{
+		handler:  handler,
+		loggers:  loggers,
+		start:    time.Now(),
+		stopChan: make(chan struct{}),
+	}
+	if logInterval > 0 {
+		go t.logPeriodically(logInterval)
+	}
+	return t
+}
+
+func (t *initProgressTracker) logPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stopChan:
+			return
+		case <-ticker.C:
+			t.lock.Lock()
+			p := t.snapshot()
+			t.lock.Unlock()
+			t.loggers.Infof("Init in progress: %s, %d of %d done, %s elapsed",
+				p.Phase, p.Done, p.Total, p.Elapsed.Round(time.Millisecond))
+		}
+	}
+}
+
+// snapshot returns the current progress. The caller must hold the lock.
+func (t *initProgressTracker) snapshot() InitProgress {
+	p := t.current
+	p.Elapsed = time.Since(t.start)
+	return p
+}
+
+// report calls the handler, if any. The caller must hold the lock; this ensures that the handler
+// is never called concurrently, even when batches are being written in parallel.
+func (t *initProgressTracker) report() {
+	if t.handler != nil {
+		t.handler(t.snapshot())
+	}
+}
+
+func (t *initProgressTracker) setPhase(phase InitPhase, total int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.current = InitProgress{Phase: phase, Total: total}
+	t.report()
+}
+
+func (t *initProgressTracker) advance(count int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.current.Done += count
+	t.report()
+}
+
+func (t *initProgressTracker) finish() {
+	close(t.stopChan)
+}
@@ -0,0 +1,102 @@
+package lddynamodb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+	"github.com/launchdarkly/go-sdk-common/v3/ldlogtest"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitProgressTracker(t *testing.T) {
+	t.Run("reports phase changes and progress to handler", func(t *testing.T) {
+		var reports []InitProgress
+		tracker := startInitProgress(func(p InitProgress) { reports = append(reports, p) }, 0, ldlog.NewDisabledLoggers())
+		tracker.setPhase(InitPhaseWriting, 10)
+		tracker.advance(4)
+		tracker.advance(6)
+		tracker.setPhase(InitPhaseDeleting, 0)
+		tracker.finish()
+
+		require.Len(t, reports, 4)
+		for i, expected := range []InitProgress{
+			{Phase: InitPhaseWriting, Done: 0, Total: 10},
+			{Phase: InitPhaseWriting, Done: 4, Total: 10},
+			{Phase: InitPhaseWriting, Done: 10, Total: 10},
+			{Phase: InitPhaseDeleting, Done: 0, Total: 0},
+		} {
+			assert.Equal(t, expected.Phase, reports[i].Phase)
+			assert.Equal(t, expected.Done, reports[i].Done)
+			assert.Equal(t, expected.Total, reports[i].Total)
+		}
+		assert.LessOrEqual(t, reports[0].Elapsed, reports[3].Elapsed)
+	})
+
+	t.Run("logs progress periodically", func(t *testing.T) {
+		mockLog := ldlogtest.NewMockLog()
+		tracker := startInitProgress(nil, time.Millisecond, mockLog.Loggers)
+		tracker.setPhase(InitPhaseWriting, 10)
+		tracker.advance(3)
+		require.Eventually(t, func() bool {
+			return mockLog.HasMessageMatch(ldlog.Info, "Init in progress: writing, 3 of 10 done")
+		}, time.Second, time.Millisecond)
+		tracker.finish()
+	})
+}
+
+func TestDataStoreReportsInitProgress(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+	require.NoError(t, clearTestData(""))
+
+	var items []ldstoretypes.KeyedSerializedItemDescriptor
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("flag%d", i)
+		items = append(items, ldstoretypes.KeyedSerializedItemDescriptor{Key: key,
+			Item: ldstoretypes.SerializedItemDescriptor{Version: 1, SerializedItem: []byte(`{}`)}})
+	}
+
+	var reports []InitProgress
+	store, err := baseDataStoreBuilder().
+		InitProgressHandler(func(p InitProgress) { reports = append(reports, p) }).
+		Build(subsystems.BasicClientContext{})
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Init([]ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: items},
+	}))
+	reports = nil
+	require.NoError(t, store.Init([]ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: items[:20]},
+	}))
+
+	type phaseCount struct {
+		phase       InitPhase
+		done, total int
+	}
+	var actual []phaseCount
+	for _, r := range reports {
+		actual = append(actual, phaseCount{r.Phase, r.Done, r.Total})
+	}
+	expected := []phaseCount{
+		{InitPhaseReadingExistingKeys, 0, 1},
+		{InitPhaseReadingExistingKeys, 1, 1},
+		{InitPhaseWriting, 0, 20},
+		{InitPhaseWriting, 20, 20},
+	}
+	for i := 0; i <= 10; i++ { // deletes are conditional, so they are done one item at a time
+		expected = append(expected, phaseCount{InitPhaseDeleting, i, 10})
+	}
+	expected = append(expected,
+		phaseCount{InitPhaseMarkingInited, 0, 1},
+		phaseCount{InitPhaseMarkingInited, 1, 1},
+	)
+	assert.Equal(t, expected, actual)
+}
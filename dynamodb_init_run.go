@@ -0,0 +1,192 @@
+package lddynamodb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldtime"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Each call to Init records its progress in a "run" item that is in the same partition as the
+// "$inited" item, so that both can be read with a single query. The run item is written as "in
+// progress" before Init starts writing data, and marked "complete" after the "$inited" item has been
+// written. If the process dies in between, the run item is left in progress, which tells later
+// readers that the data in the table may be a mixture of old and new items.
+const (
+	initRunSortKey           = "$initRun"
+	initRunIDAttr            = "runId"
+	initRunStatusAttr        = "status"
+	initRunStartedAttr       = "startedOn"
+	initRunCompletedAttr     = "completedOn"
+	initRunStatusInProgress  = "inProgress"
+	initRunStatusComplete    = "complete"
+	initRunIDLengthInBytes   = 8
+	initRunNotCompletedError = "a previous Init (run %s, started %s) did not complete, or is still in progress;" +
+		" the data in the store may be a mixture of old and new items"
+)
+
+// initRunInfo describes the most recent Init that was started for a store.
+type initRunInfo struct {
+	runID     string
+	completed bool
+	started   ldtime.UnixMillisecondTime
+}
+
+// initState is what we know about a store's initialization from the items in the "$inited" partition.
+type initState struct {
+	inited      bool
+	dataHash    string
+	environment string
+	info        *InitInfo
+	run         *initRunInfo
+}
+
+// incomplete returns true if the most recent Init was started but has not been marked complete.
+func (s initState) incomplete() bool {
+	return s.run != nil && !s.run.completed
+}
+
+func newInitRunID() string {
+	b := make([]byte, initRunIDLengthInBytes)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (store *dynamoDBDataStore) initRunKey() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		tablePartitionKey: attrValueOfString(store.initedKey()),
+		tableSortKey:      attrValueOfString(initRunSortKey),
+	}
+}
+
+// startInitRun records that an Init with the specified ID is about to start writing data.
+func (store *dynamoDBDataStore) startInitRun(ctx context.Context, runID string) error {
+	item := store.initRunKey()
+	item[initRunIDAttr] = attrValueOfString(runID)
+	item[initRunStatusAttr] = attrValueOfString(initRunStatusInProgress)
+	item[initRunStartedAttr] = attrValueOfUint64(uint64(ldtime.UnixMillisNow()))
+	if err := store.writeLimiter.wait(ctx, writeCapacityUnits(itemSize(item))); err != nil {
+		return err // COVERAGE: can't cause this in unit tests
+	}
+	_, err := store.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(store.table),
+		Item:      item,
+	}, store.apiOptions...)
+	return err
+}
+
+// completeInitRun records that the Init with the specified ID has finished. If another Init has been
+// started since then, its run item is left alone, since that Init has not finished yet.
+func (store *dynamoDBDataStore) completeInitRun(ctx context.Context, runID string) error {
+	if err := store.writeLimiter.wait(ctx, 1); err != nil {
+		return err // COVERAGE: can't cause this in unit tests
+	}
+	_, err := store.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(store.table),
+		Key:                 store.initRunKey(),
+		UpdateExpression:    aws.String("SET #status = :complete, #completed = :now"),
+		ConditionExpression: aws.String("#runId = :runId"),
+		ExpressionAttributeNames: map[string]string{
+			"#status":    initRunStatusAttr,
+			"#completed": initRunCompletedAttr,
+			"#runId":     initRunIDAttr,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":complete": attrValueOfString(initRunStatusComplete),
+			":now":      attrValueOfUint64(uint64(ldtime.UnixMillisNow())),
+			":runId":    attrValueOfString(runID),
+		},
+	}, store.apiOptions...)
+	var condCheckErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condCheckErr) {
+		store.loggers.Warnf("Another Init started while Init run %s was in progress", runID)
+		return nil
+	}
+	return err
+}
+
+// readInitState queries the "$inited" partition to find out whether the store has been initialized,
+// and whether the most recent Init completed.
+func (store *dynamoDBDataStore) readInitState(ctx context.Context) (initState, error) {
+	return store.queryInitState(ctx, store.readLimiter)
+}
+
+// queryInitState is the same as readInitState, but charges the read to the specified limiter, which
+// may be nil so that the read does not count against the read capacity limit.
+func (store *dynamoDBDataStore) queryInitState(ctx context.Context, limiter *capacityLimiter) (initState, error) {
+	var state initState
+	out, err := store.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(store.table),
+		ConsistentRead:         aws.Bool(true),
+		ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+		KeyConditions: map[string]types.Condition{
+			tablePartitionKey: {
+				ComparisonOperator: types.ComparisonOperatorEq,
+				AttributeValueList: []types.AttributeValue{attrValueOfString(store.initedKey())},
+			},
+		},
+	}, store.apiOptions...)
+	if err != nil {
+		return state, err
+	}
+	limiter.charge(consumedReadCapacityUnits(out, queryReadCapacityUnits(out.Items)))
+	for _, item := range out.Items {
+		switch attrValueToString(item[tableSortKey]) {
+		case store.initedKey():
+			state.inited = true
+			state.dataHash = attrValueToString(item[initedDataHashAttr])
+			state.environment = attrValueToString(item[initedEnvironmentAttr])
+			state.info = initInfoFromItem(item)
+		case initRunSortKey:
+			state.run = &initRunInfo{
+				runID:     attrValueToString(item[initRunIDAttr]),
+				completed: attrValueToString(item[initRunStatusAttr]) == initRunStatusComplete,
+				started:   ldtime.UnixMillisecondTime(attrValueToUint64(item[initRunStartedAttr])),
+			}
+		}
+	}
+	store.rememberTableEnvironment(state.environment)
+	return state, nil
+}
+
+// reportIncompleteInit logs a warning if the most recent Init did not complete. It only logs once for
+// each run, since IsInitialized may be called repeatedly.
+func (store *dynamoDBDataStore) reportIncompleteInit(state initState) {
+	store.lock.Lock()
+	store.checkedIncompleteInit = true
+	alreadyReported := true
+	if state.incomplete() {
+		alreadyReported = store.reportedIncompleteRunID == state.run.runID
+		store.reportedIncompleteRunID = state.run.runID
+	}
+	store.lock.Unlock()
+	if !alreadyReported {
+		started := time.UnixMilli(int64(state.run.started)).UTC().Format(time.RFC3339)
+		store.loggers.Warnf(initRunNotCompletedError, state.run.runID, started)
+	}
+}
+
+// checkForIncompleteInit is called by Init before it starts writing, so that an interrupted Init is
+// reported even if the SDK never asked whether the store was initialized. It does nothing if the state
+// of the table has already been read, and it does not count against the read capacity limit.
+func (store *dynamoDBDataStore) checkForIncompleteInit(ctx context.Context) {
+	store.lock.Lock()
+	checked := store.checkedIncompleteInit
+	store.lock.Unlock()
+	if checked {
+		return
+	}
+	state, err := store.queryInitState(ctx, nil)
+	if err != nil {
+		store.loggers.Debugf("Unable to check for an incomplete Init (error=%s)", err)
+		return
+	}
+	store.reportIncompleteInit(state)
+}
@@ -0,0 +1,89 @@
+package lddynamodb
+
+import (
+	"testing"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+	"github.com/launchdarkly/go-sdk-common/v3/ldlogtest"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataStoreDetectsIncompleteInit(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	allData := []ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+			{Key: "flag1", Item: ldstoretypes.SerializedItemDescriptor{Version: 1, SerializedItem: []byte(`{}`)}},
+		}},
+	}
+
+	makeStore := func(t *testing.T, builder *StoreBuilder[subsystems.PersistentDataStore]) (
+		*dynamoDBDataStore, *ldlogtest.MockLog) {
+		mockLog := ldlogtest.NewMockLog()
+		ctx := subsystems.BasicClientContext{}
+		ctx.Logging.Loggers = mockLog.Loggers
+		store, err := builder.Build(ctx)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store.(*dynamoDBDataStore), mockLog
+	}
+
+	t.Run("completed Init is recorded", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store, mockLog := makeStore(t, baseDataStoreBuilder())
+		require.NoError(t, store.Init(allData))
+
+		state, err := store.readInitState(store.context)
+		require.NoError(t, err)
+		assert.True(t, state.inited)
+		require.NotNil(t, state.run)
+		assert.True(t, state.run.completed)
+		assert.NotEqual(t, "", state.run.runID)
+
+		assert.True(t, store.IsInitialized())
+		assert.Len(t, mockLog.GetOutput(ldlog.Warn), 0)
+	})
+
+	t.Run("interrupted Init is reported", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		writer, _ := makeStore(t, baseDataStoreBuilder())
+		require.NoError(t, writer.Init(allData))
+		require.NoError(t, writer.startInitRun(writer.context, "run1")) // simulate a second Init that never finished
+
+		store, mockLog := makeStore(t, baseDataStoreBuilder())
+		assert.Len(t, mockLog.GetOutput(ldlog.Warn), 0) // not checked until the store is used
+		assert.True(t, store.IsInitialized())
+		mockLog.AssertMessageMatch(t, true, ldlog.Warn, "run run1.*did not complete")
+		assert.True(t, store.IsInitialized())
+		assert.Len(t, mockLog.GetOutput(ldlog.Warn), 1) // only reported once per run
+
+		strictStore, _ := makeStore(t, baseDataStoreBuilder().RequireCompleteInit())
+		assert.False(t, strictStore.IsInitialized())
+
+		require.NoError(t, writer.startInitRun(writer.context, "run2"))
+		initStore, initLog := makeStore(t, baseDataStoreBuilder())
+		require.NoError(t, initStore.Init(allData)) // Init checks before it starts its own run
+		initLog.AssertMessageMatch(t, true, ldlog.Warn, "run run2.*did not complete")
+		assert.True(t, strictStore.IsInitialized())
+	})
+
+	t.Run("Init does not mark a newer run complete", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store, mockLog := makeStore(t, baseDataStoreBuilder())
+		require.NoError(t, store.startInitRun(store.context, "run1"))
+		require.NoError(t, store.startInitRun(store.context, "run2"))
+		require.NoError(t, store.completeInitRun(store.context, "run1"))
+		mockLog.AssertMessageMatch(t, true, ldlog.Warn, "Another Init started while Init run run1 was in progress")
+
+		state, err := store.readInitState(store.context)
+		require.NoError(t, err)
+		require.NotNil(t, state.run)
+		assert.Equal(t, "run2", state.run.runID)
+		assert.False(t, state.run.completed)
+	})
+}
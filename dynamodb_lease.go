@@ -0,0 +1,221 @@
+package lddynamodb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldtime"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// When the writer lease is enabled, all of the data stores that share a prefix compete for a single
+// "$lease" item. Whichever store manages to write its own ID into that item, using a conditional write
+// that only succeeds if the item does not exist, already belongs to that store, or has expired, is the
+// lease holder and is the only one that writes data. Every store periodically tries to claim or renew
+// the lease, so if the holder stops renewing it, another store takes over when it expires.
+const (
+	leaseOwnerAttr   = "owner"
+	leaseExpiresAttr = "expiresOn"
+)
+
+// errWriterNeedsInit is returned by Upsert when this store has taken over the writer lease and has not
+// been initialized since then. The SDK treats the error as a store outage, and once IsStoreAvailable
+// reports that the store is available again, it initializes the store with a full data set.
+var errWriterNeedsInit = errors.New(
+	"this instance has just become the writer, so the store must be initialized before it can be updated")
+
+// errLostWriterLease is returned by Init if this store's writer lease expired, or was taken over by
+// another store, while Init was writing.
+var errLostWriterLease = errors.New("this instance lost the writer lease while initializing the store")
+
+// writerLease manages one data store's claim on the writer lease.
+type writerLease struct {
+	store     *dynamoDBDataStore
+	owner     string
+	duration  time.Duration
+	context   context.Context
+	cancel    func()
+	lock      sync.Mutex
+	heldUntil time.Time
+	attempted bool
+	needsInit bool
+	firstTry  sync.Once
+	closeChan chan struct{}
+	closeOnce sync.Once
+	doneChan  chan struct{}
+}
+
+// defaultWriterID returns an ID that is unique to this data store instance, but that still tells a
+// human reader which host it is running on.
+func defaultWriterID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown" // COVERAGE: can't cause this in unit tests
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return hostname + "-" + hex.EncodeToString(suffix)
+}
+
+func newWriterLease(store *dynamoDBDataStore, owner string, duration time.Duration) *writerLease {
+	ctx, cancel := context.WithCancel(store.context)
+	lease := &writerLease{
+		store:     store,
+		owner:     owner,
+		duration:  duration,
+		context:   ctx,
+		cancel:    cancel,
+		closeChan: make(chan struct{}),
+		doneChan:  make(chan struct{}),
+	}
+	go lease.run()
+	return lease
+}
+
+func (l *writerLease) run() {
+	defer close(l.doneChan)
+	l.firstTry.Do(l.claim)
+	ticker := time.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.closeChan:
+			return
+		case <-ticker.C:
+			l.claim()
+		}
+	}
+}
+
+func (l *writerLease) leaseKey() map[string]types.AttributeValue {
+	key := l.store.prefixedNamespace("$lease")
+	return map[string]types.AttributeValue{
+		tablePartitionKey: attrValueOfString(key),
+		tableSortKey:      attrValueOfString(key),
+	}
+}
+
+// isHolder returns true if this store currently holds the lease. If the store has not yet tried to
+// claim the lease, it does so first, so that the first Init after startup is not skipped needlessly.
+func (l *writerLease) isHolder() bool {
+	l.firstTry.Do(l.claim)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return time.Now().Before(l.heldUntil)
+}
+
+// mustInit returns true if this store took over the lease from another store, or acquired it after
+// an Init that it skipped, and has not been initialized since then: any updates that were received
+// while no store held the lease were not written, so the data may be out of date.
+func (l *writerLease) mustInit() bool {
+	if l == nil {
+		return false
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.needsInit
+}
+
+// initialized is called when the store has been initialized with a full data set.
+func (l *writerLease) initialized() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	l.needsInit = false
+	l.lock.Unlock()
+}
+
+// claim tries to acquire the lease, or to renew it if we already hold it.
+func (l *writerLease) claim() {
+	// We measure the lease period from before the request, so that we will consider it expired
+	// slightly before any other store could. The request is counted against the write capacity limit,
+	// but does not wait for it, since a large Init could otherwise delay it until the lease expired.
+	now := time.Now()
+	item := l.leaseKey()
+	item[leaseOwnerAttr] = attrValueOfString(l.owner)
+	item[leaseExpiresAttr] = attrValueOfUint64(uint64(ldtime.UnixMillisFromTime(now.Add(l.duration))))
+	_, err := l.store.client.PutItem(l.context, &dynamodb.PutItemInput{
+		TableName: aws.String(l.store.table),
+		Item:      item,
+		ConditionExpression: aws.String(
+			"attribute_not_exists(#namespace) or #owner = :owner or #expires < :now",
+		),
+		ExpressionAttributeNames: map[string]string{
+			"#namespace": tablePartitionKey,
+			"#owner":     leaseOwnerAttr,
+			"#expires":   leaseExpiresAttr,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": attrValueOfString(l.owner),
+			":now":   attrValueOfUint64(uint64(ldtime.UnixMillisFromTime(now))),
+		},
+	}, l.store.apiOptions...)
+	l.store.writeLimiter.charge(1)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	wasHolder := now.Before(l.heldUntil)
+	firstAttempt := !l.attempted
+	l.attempted = true
+	if err == nil {
+		l.heldUntil = now.Add(l.duration)
+		if !wasHolder {
+			l.store.loggers.Infof("Acquired writer lease as %q; this instance will write data", l.owner)
+			if !firstAttempt {
+				// The first attempt happens before the store is used, so the SDK's first Init is enough.
+				l.needsInit = true
+			}
+		}
+		return
+	}
+	var condCheckErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condCheckErr) {
+		l.heldUntil = time.Time{}
+		if wasHolder {
+			l.store.loggers.Warnf("Lost writer lease; another instance is now writing data")
+		}
+		return
+	}
+	// For any other error, we don't know whether our claim succeeded, so we keep acting as the holder
+	// until our existing claim expires, but no longer.
+	if l.context.Err() == nil {
+		l.store.loggers.Warnf("Unable to renew writer lease: %s", err)
+	}
+}
+
+// close stops renewing the lease, and gives it up if we hold it so that another store can take over
+// without waiting for it to expire.
+func (l *writerLease) close() {
+	l.closeOnce.Do(func() {
+		close(l.closeChan)
+		l.cancel()
+		<-l.doneChan
+		l.lock.Lock()
+		held := time.Now().Before(l.heldUntil)
+		l.heldUntil = time.Time{}
+		l.lock.Unlock()
+		if !held {
+			return
+		}
+		_, err := l.store.client.DeleteItem(l.store.context, &dynamodb.DeleteItemInput{
+			TableName:                 aws.String(l.store.table),
+			Key:                       l.leaseKey(),
+			ConditionExpression:       aws.String("#owner = :owner"),
+			ExpressionAttributeNames:  map[string]string{"#owner": leaseOwnerAttr},
+			ExpressionAttributeValues: map[string]types.AttributeValue{":owner": attrValueOfString(l.owner)},
+		}, l.store.apiOptions...)
+		l.store.writeLimiter.charge(1)
+		if err != nil {
+			l.store.loggers.Debugf("Unable to release writer lease (owner=%s error=%s)", l.owner, err)
+		}
+	})
+}
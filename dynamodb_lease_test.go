@@ -0,0 +1,221 @@
+package lddynamodb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldtime"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataStoreWriterLease(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	makeData := func(version int) []ldstoretypes.SerializedCollection {
+		return []ldstoretypes.SerializedCollection{
+			{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+				{Key: "flag1", Item: ldstoretypes.SerializedItemDescriptor{Version: version, SerializedItem: []byte(`{}`)}},
+			}},
+		}
+	}
+	itemVersion := func(version int) ldstoretypes.SerializedItemDescriptor {
+		return ldstoretypes.SerializedItemDescriptor{Version: version, SerializedItem: []byte(`{}`)}
+	}
+
+	makeStore := func(t *testing.T, id string, duration time.Duration) *dynamoDBDataStore {
+		store, err := baseDataStoreBuilder().WriterLease(duration).WriterID(id).Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store.(*dynamoDBDataStore)
+	}
+
+	getVersion := func(t *testing.T, store *dynamoDBDataStore) int {
+		item, err := store.Get(ldstoreimpl.Features(), "flag1")
+		require.NoError(t, err)
+		return item.Version
+	}
+
+	t.Run("only the lease holder writes", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		holder := makeStore(t, "a", time.Minute)
+		require.True(t, holder.isWriter())
+		reader := makeStore(t, "b", time.Minute)
+		assert.False(t, reader.isWriter())
+
+		require.NoError(t, reader.Init(makeData(1)))
+		assert.False(t, reader.IsInitialized())
+
+		require.NoError(t, holder.Init(makeData(1)))
+		assert.True(t, reader.IsInitialized())
+
+		updated, err := reader.Upsert(ldstoreimpl.Features(), "flag1", itemVersion(2))
+		require.NoError(t, err)
+		assert.False(t, updated)
+		assert.Equal(t, 1, getVersion(t, holder))
+
+		updated, err = holder.Upsert(ldstoreimpl.Features(), "flag1", itemVersion(2))
+		require.NoError(t, err)
+		assert.True(t, updated)
+		assert.Equal(t, 2, getVersion(t, reader))
+	})
+
+	t.Run("closing the holder lets another store take over", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		holder := makeStore(t, "a", 300*time.Millisecond)
+		require.True(t, holder.isWriter())
+		reader := makeStore(t, "b", 300*time.Millisecond)
+		assert.False(t, reader.isWriter())
+
+		require.NoError(t, holder.Close())
+		require.Eventually(t, reader.isWriter, time.Second, 10*time.Millisecond)
+
+		require.NoError(t, reader.Init(makeData(1)))
+		assert.True(t, reader.IsInitialized())
+	})
+
+	t.Run("store that takes over the lease must be initialized before it writes updates", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		holder := makeStore(t, "a", 300*time.Millisecond)
+		require.True(t, holder.isWriter())
+		reader := makeStore(t, "b", 300*time.Millisecond)
+		assert.False(t, reader.isWriter())
+		require.NoError(t, holder.Init(makeData(1)))
+
+		require.NoError(t, holder.Close())
+		require.Eventually(t, reader.isWriter, time.Second, 10*time.Millisecond)
+
+		_, err := reader.Upsert(ldstoreimpl.Features(), "flag1", itemVersion(3))
+		assert.ErrorIs(t, err, errWriterNeedsInit)
+		assert.True(t, reader.IsStoreAvailable())
+
+		require.NoError(t, reader.Init(makeData(2)))
+		updated, err := reader.Upsert(ldstoreimpl.Features(), "flag1", itemVersion(3))
+		require.NoError(t, err)
+		assert.True(t, updated)
+		assert.Equal(t, 3, getVersion(t, reader))
+	})
+
+	t.Run("lease claims count against the write capacity limit", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store, err := baseDataStoreBuilder().WriterLease(time.Minute).WriteCapacityLimit(0.01, 5).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+		require.True(t, store.(*dynamoDBDataStore).isWriter())
+
+		limiter := store.(*dynamoDBDataStore).writeLimiter
+		limiter.lock.Lock()
+		defer limiter.lock.Unlock()
+		assert.Less(t, limiter.tokens, 4.1)
+	})
+
+	t.Run("updates that are not written do not use write capacity", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		holder := makeStore(t, "a", time.Minute)
+		require.True(t, holder.isWriter())
+		store, err := baseDataStoreBuilder().WriterLease(time.Minute).WriterID("b").WriteCapacityLimit(0.01, 5).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+		reader := store.(*dynamoDBDataStore)
+		require.False(t, reader.isWriter())
+
+		tokens := func() float64 {
+			reader.writeLimiter.lock.Lock()
+			defer reader.writeLimiter.lock.Unlock()
+			return reader.writeLimiter.tokens
+		}
+		before := tokens()
+		updated, err := reader.Upsert(ldstoreimpl.Features(), "flag1", itemVersion(2))
+		require.NoError(t, err)
+		assert.False(t, updated)
+		assert.GreaterOrEqual(t, tokens(), before)
+	})
+
+	t.Run("renewal does not wait for write capacity", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store, err := baseDataStoreBuilder().WriterLease(time.Minute).WriteCapacityLimit(0.01, 1).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+		holder := store.(*dynamoDBDataStore)
+		require.True(t, holder.isWriter())
+
+		holder.writeLimiter.charge(100) // as if a large Init had used all of the capacity
+		renewed := make(chan struct{})
+		go func() {
+			holder.lease.claim()
+			close(renewed)
+		}()
+		select {
+		case <-renewed:
+		case <-time.After(time.Second):
+			require.Fail(t, "timed out waiting for lease renewal")
+		}
+		assert.True(t, holder.isWriter())
+	})
+
+	t.Run("Init stops if the lease expires while it is running", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		var holder *dynamoDBDataStore
+		store, err := baseDataStoreBuilder().WriterLease(time.Minute).WriterID("a").
+			InitProgressHandler(func(p InitProgress) {
+				if p.Phase == InitPhaseDeleting {
+					// Another instance takes over after this one's lease has expired
+					item := holder.lease.leaseKey()
+					item[leaseOwnerAttr] = attrValueOfString("b")
+					item[leaseExpiresAttr] = attrValueOfUint64(uint64(ldtime.UnixMillisFromTime(time.Now().Add(time.Minute))))
+					_, err := holder.client.PutItem(holder.context, &dynamodb.PutItemInput{
+						TableName: aws.String(holder.table), Item: item,
+					})
+					require.NoError(t, err)
+					holder.lease.lock.Lock()
+					holder.lease.heldUntil = time.Now()
+					holder.lease.lock.Unlock()
+				}
+			}).Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+		holder = store.(*dynamoDBDataStore)
+		require.True(t, holder.isWriter())
+
+		err = holder.Init(makeData(1))
+		assert.ErrorIs(t, err, errLostWriterLease)
+		assert.False(t, holder.IsInitialized())
+		assert.False(t, holder.isWriter())
+	})
+
+	t.Run("expired lease can be claimed", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		client := createTestClient()
+		item := (&writerLease{store: &dynamoDBDataStore{}}).leaseKey()
+		item[leaseOwnerAttr] = attrValueOfString("someone-else")
+		item[leaseExpiresAttr] = attrValueOfUint64(uint64(ldtime.UnixMillisNow() - 1000))
+		_, err := client.PutItem(context.Background(), &dynamodb.PutItemInput{
+			TableName: aws.String(testTableName),
+			Item:      item,
+		})
+		require.NoError(t, err)
+
+		store := makeStore(t, "b", time.Minute)
+		assert.True(t, store.isWriter())
+	})
+
+	t.Run("unexpired lease held by another writer is respected", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		holder := makeStore(t, "a", time.Minute)
+		require.True(t, holder.isWriter())
+
+		store := makeStore(t, "b", time.Minute)
+		assert.False(t, store.isWriter())
+		assert.True(t, holder.isWriter())
+	})
+}
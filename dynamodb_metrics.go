@@ -0,0 +1,289 @@
+package lddynamodb
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// MetricLabels identifies what a measurement reported to [Metrics] applies to.
+type MetricLabels struct {
+	// Table is the name of the DynamoDB table.
+	Table string
+	// Prefix is the store's key prefix, which is "" if there is none.
+	Prefix string
+	// Operation is the name of the DynamoDB API operation, such as "GetItem", "Query", "PutItem", or
+	// "BatchWriteItem".
+	Operation string
+}
+
+// Metrics receives measurements of the DynamoDB requests made by a data store or Big Segment store,
+// so that an application can export them to a monitoring system. See [StoreBuilder.Metrics].
+//
+// This package provides an implementation that publishes the measurements with the standard expvar
+// package, [ExpvarMetrics], and the ldprometheus subpackage provides one that registers them with
+// Prometheus. The methods may be called concurrently from many goroutines, and should return quickly.
+type Metrics interface {
+	// ObserveRequestDuration is called after each DynamoDB request, successful or not, with the time
+	// it took, including any retries done by the AWS SDK.
+	ObserveRequestDuration(labels MetricLabels, duration time.Duration)
+
+	// IncrementErrors is called when a DynamoDB request fails, other than because of a conditional
+	// check. The error type is the error code returned by DynamoDB, such as
+	// "ProvisionedThroughputExceededException" or "ResourceNotFoundException", or else "Canceled" if
+	// the store was closed or the request timed out, or "Other".
+	IncrementErrors(labels MetricLabels, errorType string)
+
+	// IncrementConditionalCheckFailures is called when DynamoDB rejects a write because of its
+	// condition, as happens when the store already has the same or a newer version of an item.
+	IncrementConditionalCheckFailures(labels MetricLabels, count int)
+
+	// IncrementItemsTooLarge is called when the store drops an item because it is too large for
+	// DynamoDB. The operation is the one that would have written the item.
+	IncrementItemsTooLarge(labels MetricLabels, count int)
+
+	// IncrementBatchRetries is called when the store retries a BatchWriteItem request because DynamoDB
+	// did not process all of its items.
+	IncrementBatchRetries(labels MetricLabels)
+
+	// AddUnprocessedItems is called with the number of items that DynamoDB did not process in a
+	// BatchWriteItem request.
+	AddUnprocessedItems(labels MetricLabels, count int)
+}
+
+// Error types reported to Metrics.IncrementErrors for errors that did not come from DynamoDB
+const (
+	metricErrorTypeCanceled = "Canceled"
+	metricErrorTypeOther    = "Other"
+)
+
+// storeMetrics reports measurements for one store to the application's Metrics. All of its methods
+// can be called on a nil *storeMetrics, meaning that metrics are disabled.
+type storeMetrics struct {
+	metrics Metrics
+	table   string
+	prefix  string
+}
+
+func newStoreMetrics(metrics Metrics, table, prefix string) *storeMetrics {
+	if metrics == nil {
+		return nil
+	}
+	return &storeMetrics{metrics: metrics, table: table, prefix: prefix}
+}
+
+func (m *storeMetrics) labels(table, operation string) MetricLabels {
+	if table == "" {
+		table = m.table
+	}
+	return MetricLabels{Table: table, Prefix: m.prefix, Operation: operation}
+}
+
+func (m *storeMetrics) itemsTooLarge(table, operation string, count int) {
+	if m != nil {
+		m.metrics.IncrementItemsTooLarge(m.labels(table, operation), count)
+	}
+}
+
+func (m *storeMetrics) batchRetry(table string, unprocessed int) {
+	if m != nil {
+		labels := m.labels(table, "BatchWriteItem")
+		m.metrics.IncrementBatchRetries(labels)
+		m.metrics.AddUnprocessedItems(labels, unprocessed)
+	}
+}
+
+// addMiddleware is passed to each DynamoDB client call when metrics are enabled.
+func (m *storeMetrics) addMiddleware(options *dynamodb.Options) {
+	options.APIOptions = append(options.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("LaunchDarklyMetrics", m.handleInitialize),
+			middleware.After)
+	})
+}
+
+func (m *storeMetrics) handleInitialize(
+	ctx context.Context,
+	in middleware.InitializeInput,
+	next middleware.InitializeHandler,
+) (middleware.InitializeOutput, middleware.Metadata, error) {
+	startTime := time.Now()
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	labels := m.labels(tableOfRequest(in.Parameters), awsmiddleware.GetOperationName(ctx))
+	m.metrics.ObserveRequestDuration(labels, time.Since(startTime))
+	if err == nil {
+		return out, metadata, err
+	}
+	if failures := conditionalCheckFailures(err); failures > 0 {
+		m.metrics.IncrementConditionalCheckFailures(labels, failures)
+		return out, metadata, err
+	}
+	var apiErr smithy.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		m.metrics.IncrementErrors(labels, apiErr.ErrorCode())
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		m.metrics.IncrementErrors(labels, metricErrorTypeCanceled)
+	default:
+		m.metrics.IncrementErrors(labels, metricErrorTypeOther)
+	}
+	return out, metadata, err
+}
+
+// conditionalCheckFailures returns the number of writes that failed because of their conditions.
+func conditionalCheckFailures(err error) int {
+	var condCheckErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condCheckErr) {
+		return 1
+	}
+	count := 0
+	var canceledErr *types.TransactionCanceledException
+	if errors.As(err, &canceledErr) {
+		for _, reason := range canceledErr.CancellationReasons {
+			if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// tableOfRequest returns the table that a request is for, or "" if it is not for exactly one table.
+func tableOfRequest(params interface{}) string {
+	switch input := params.(type) {
+	case *dynamodb.GetItemInput:
+		return aws.ToString(input.TableName)
+	case *dynamodb.QueryInput:
+		return aws.ToString(input.TableName)
+	case *dynamodb.PutItemInput:
+		return aws.ToString(input.TableName)
+	case *dynamodb.UpdateItemInput:
+		return aws.ToString(input.TableName)
+	case *dynamodb.DeleteItemInput:
+		return aws.ToString(input.TableName)
+	case *dynamodb.BatchWriteItemInput:
+		if len(input.RequestItems) == 1 {
+			for table := range input.RequestItems {
+				return table
+			}
+		}
+	}
+	return ""
+}
+
+// Names of the variables in the map published by ExpvarMetrics
+const (
+	expvarRequests                 = "requests"
+	expvarRequestMillis            = "requestMillis"
+	expvarErrors                   = "errors"
+	expvarConditionalCheckFailures = "conditionalCheckFailures"
+	expvarItemsTooLarge            = "itemsTooLarge"
+	expvarBatchRetries             = "batchRetries"
+	expvarUnprocessedItems         = "unprocessedItems"
+)
+
+var expvarPublishLock sync.Mutex
+
+type expvarMetrics struct {
+	requests                 *expvar.Map
+	requestMillis            *expvar.Map
+	errors                   *expvar.Map
+	conditionalCheckFailures *expvar.Map
+	itemsTooLarge            *expvar.Map
+	batchRetries             *expvar.Map
+	unprocessedItems         *expvar.Map
+}
+
+// ExpvarMetrics returns a [Metrics] implementation that publishes the measurements with the standard
+// expvar package, as a map with the specified name. If a map with that name has already been
+// published, for instance by another store, the measurements are added to it. It returns an error if
+// a variable with that name has been published that is not a map of the same kind.
+//
+// The map contains the maps "requests" (the number of requests), "requestMillis" (their total
+// duration in milliseconds), "errors", "conditionalCheckFailures", "itemsTooLarge", "batchRetries",
+// and "unprocessedItems". Their keys have the form "table:prefix:operation"; for "errors", the error
+// type is added as another ":"-separated part. Any "%" or ":" characters in the parts, which can only
+// happen in the prefix, are escaped as "%25" and "%3A", so that the parts can always be told apart.
+func ExpvarMetrics(name string) (Metrics, error) {
+	expvarPublishLock.Lock()
+	defer expvarPublishLock.Unlock()
+	var top *expvar.Map
+	switch v := expvar.Get(name).(type) {
+	case nil:
+		top = expvar.NewMap(name)
+	case *expvar.Map:
+		top = v
+	default:
+		return nil, fmt.Errorf("expvar variable %q has already been published, and is not a map", name)
+	}
+	m := &expvarMetrics{}
+	for _, sub := range []struct {
+		key   string
+		value **expvar.Map
+	}{
+		{expvarRequests, &m.requests},
+		{expvarRequestMillis, &m.requestMillis},
+		{expvarErrors, &m.errors},
+		{expvarConditionalCheckFailures, &m.conditionalCheckFailures},
+		{expvarItemsTooLarge, &m.itemsTooLarge},
+		{expvarBatchRetries, &m.batchRetries},
+		{expvarUnprocessedItems, &m.unprocessedItems},
+	} {
+		switch v := top.Get(sub.key).(type) {
+		case nil:
+			*sub.value = new(expvar.Map)
+			top.Set(sub.key, *sub.value)
+		case *expvar.Map:
+			*sub.value = v
+		default:
+			return nil, fmt.Errorf("expvar map %q already has a %q value that is not a map", name, sub.key)
+		}
+	}
+	return m, nil
+}
+
+var expvarKeyEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
+func expvarKey(labels MetricLabels, extra ...string) string {
+	parts := append([]string{labels.Table, labels.Prefix, labels.Operation}, extra...)
+	for i, part := range parts {
+		parts[i] = expvarKeyEscaper.Replace(part)
+	}
+	return strings.Join(parts, ":")
+}
+
+func (m *expvarMetrics) ObserveRequestDuration(labels MetricLabels, duration time.Duration) {
+	key := expvarKey(labels)
+	m.requests.Add(key, 1)
+	m.requestMillis.AddFloat(key, float64(duration)/float64(time.Millisecond))
+}
+
+func (m *expvarMetrics) IncrementErrors(labels MetricLabels, errorType string) {
+	m.errors.Add(expvarKey(labels, errorType), 1)
+}
+
+func (m *expvarMetrics) IncrementConditionalCheckFailures(labels MetricLabels, count int) {
+	m.conditionalCheckFailures.Add(expvarKey(labels), int64(count))
+}
+
+func (m *expvarMetrics) IncrementItemsTooLarge(labels MetricLabels, count int) {
+	m.itemsTooLarge.Add(expvarKey(labels), int64(count))
+}
+
+func (m *expvarMetrics) IncrementBatchRetries(labels MetricLabels) {
+	m.batchRetries.Add(expvarKey(labels), 1)
+}
+
+func (m *expvarMetrics) AddUnprocessedItems(labels MetricLabels, count int) {
+	m.unprocessedItems.Add(expvarKey(labels), int64(count))
+}
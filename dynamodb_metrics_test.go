@@ -0,0 +1,187 @@
+package lddynamodb
+
+import (
+	"expvar"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedMetrics struct {
+	lock                     sync.Mutex
+	requests                 map[MetricLabels]int
+	errors                   map[MetricLabels][]string
+	conditionalCheckFailures map[MetricLabels]int
+	itemsTooLarge            map[MetricLabels]int
+}
+
+func newRecordedMetrics() *recordedMetrics {
+	return &recordedMetrics{
+		requests:                 make(map[MetricLabels]int),
+		errors:                   make(map[MetricLabels][]string),
+		conditionalCheckFailures: make(map[MetricLabels]int),
+		itemsTooLarge:            make(map[MetricLabels]int),
+	}
+}
+
+func (m *recordedMetrics) ObserveRequestDuration(labels MetricLabels, duration time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.requests[labels]++
+}
+
+func (m *recordedMetrics) IncrementErrors(labels MetricLabels, errorType string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.errors[labels] = append(m.errors[labels], errorType)
+}
+
+func (m *recordedMetrics) IncrementConditionalCheckFailures(labels MetricLabels, count int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.conditionalCheckFailures[labels] += count
+}
+
+func (m *recordedMetrics) IncrementItemsTooLarge(labels MetricLabels, count int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.itemsTooLarge[labels] += count
+}
+
+func (m *recordedMetrics) IncrementBatchRetries(labels MetricLabels)          {}
+func (m *recordedMetrics) AddUnprocessedItems(labels MetricLabels, count int) {}
+
+func TestStoreMetrics(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	flag := func(version int) ldstoretypes.SerializedItemDescriptor {
+		return ldstoretypes.SerializedItemDescriptor{Version: version, SerializedItem: []byte(`{}`)}
+	}
+	labels := func(prefix, operation string) MetricLabels {
+		return MetricLabels{Table: testTableName, Prefix: prefix, Operation: operation}
+	}
+
+	t.Run("data store", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		metrics := newRecordedMetrics()
+		store, err := baseDataStoreBuilder().Metrics(metrics).Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+
+		require.NoError(t, store.Init([]ldstoretypes.SerializedCollection{
+			{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+				{Key: "flag1", Item: flag(1)},
+			}},
+		}))
+		_, err = store.Get(ldstoreimpl.Features(), "flag1")
+		require.NoError(t, err)
+		_, err = store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		updated, err := store.Upsert(ldstoreimpl.Features(), "flag1", flag(1))
+		require.NoError(t, err)
+		require.False(t, updated)
+
+		tooLarge := ldstoretypes.SerializedItemDescriptor{Version: 2,
+			SerializedItem: []byte(`"` + strings.Repeat("x", dynamoDbMaxItemSize) + `"`)}
+		updated, err = store.Upsert(ldstoreimpl.Features(), "flag1", tooLarge)
+		require.NoError(t, err)
+		require.False(t, updated)
+
+		metrics.lock.Lock()
+		defer metrics.lock.Unlock()
+		assert.Greater(t, metrics.requests[labels("", "BatchWriteItem")], 0)
+		assert.Greater(t, metrics.requests[labels("", "GetItem")], 0)
+		assert.Greater(t, metrics.requests[labels("", "Query")], 0)
+		assert.Greater(t, metrics.requests[labels("", "PutItem")], 0)
+		assert.Equal(t, 1, metrics.conditionalCheckFailures[labels("", "PutItem")])
+		assert.Equal(t, 1, metrics.itemsTooLarge[labels("", "PutItem")])
+		assert.Len(t, metrics.errors, 0)
+	})
+
+	t.Run("data store error", func(t *testing.T) {
+		metrics := newRecordedMetrics()
+		store, err := DataStore("nonexistent-table").ClientOptions(makeTestOptions()).Metrics(metrics).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+
+		_, err = store.Get(ldstoreimpl.Features(), "flag1")
+		require.Error(t, err)
+
+		metrics.lock.Lock()
+		defer metrics.lock.Unlock()
+		errorLabels := MetricLabels{Table: "nonexistent-table", Operation: "GetItem"}
+		assert.Equal(t, []string{"ResourceNotFoundException"}, metrics.errors[errorLabels])
+	})
+
+	t.Run("Big Segment store", func(t *testing.T) {
+		metrics := newRecordedMetrics()
+		store, err := BigSegmentStore(testTableName).ClientOptions(makeTestOptions()).Prefix("measured").
+			Metrics(metrics).Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+
+		_, err = store.GetMetadata()
+		require.NoError(t, err)
+		_, err = store.GetMembership("abc")
+		require.NoError(t, err)
+
+		metrics.lock.Lock()
+		defer metrics.lock.Unlock()
+		assert.Equal(t, 2, metrics.requests[labels("measured", "GetItem")])
+	})
+
+	t.Run("expvar", func(t *testing.T) {
+		metrics, err := ExpvarMetrics("lddynamodbTest")
+		require.NoError(t, err)
+		_, err = ExpvarMetrics("lddynamodbTest") // reuses the published map
+		require.NoError(t, err)
+
+		labels := labels("p", "PutItem")
+		metrics.ObserveRequestDuration(labels, 3*time.Millisecond)
+		metrics.IncrementErrors(labels, "ProvisionedThroughputExceededException")
+		metrics.IncrementConditionalCheckFailures(labels, 2)
+
+		published := expvar.Get("lddynamodbTest").(*expvar.Map)
+		key := testTableName + ":p:PutItem"
+		assert.Equal(t, "1", published.Get("requests").(*expvar.Map).Get(key).String())
+		assert.Equal(t, "3", published.Get("requestMillis").(*expvar.Map).Get(key).String())
+		assert.Equal(t, "1", published.Get("errors").(*expvar.Map).
+			Get(key+":ProvisionedThroughputExceededException").String())
+		assert.Equal(t, "2", published.Get("conditionalCheckFailures").(*expvar.Map).Get(key).String())
+	})
+
+	t.Run("expvar key parts are escaped", func(t *testing.T) {
+		metrics, err := ExpvarMetrics("lddynamodbEscapeTest")
+		require.NoError(t, err)
+		metrics.IncrementItemsTooLarge(MetricLabels{Table: "t", Prefix: "a:b%c", Operation: "PutItem"}, 1)
+
+		published := expvar.Get("lddynamodbEscapeTest").(*expvar.Map)
+		assert.Equal(t, "1", published.Get("itemsTooLarge").(*expvar.Map).Get("t:a%3Ab%25c:PutItem").String())
+	})
+
+	t.Run("expvar name that is not a map is rejected", func(t *testing.T) {
+		expvar.NewInt("lddynamodbIntTest")
+		_, err := ExpvarMetrics("lddynamodbIntTest")
+		assert.Error(t, err)
+
+		expvar.NewMap("lddynamodbOtherMapTest").Add(expvarRequests, 1)
+		_, err = ExpvarMetrics("lddynamodbOtherMapTest")
+		assert.Error(t, err)
+	})
+
+	t.Run("metrics are disabled by default", func(t *testing.T) {
+		store, err := baseDataStoreBuilder().Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+		assert.Nil(t, store.(*dynamoDBDataStore).metrics)
+	})
+}
@@ -0,0 +1,345 @@
+package lddynamodb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+	"github.com/launchdarkly/go-sdk-common/v3/ldvalue"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+)
+
+// MigrationStage is a stage of moving data from one DynamoDB table or prefix to another with
+// [MigrationDataStore].
+type MigrationStage int
+
+const (
+	// MigrationReadOld means that writes go to both the old and the new location, and reads come from
+	// the old one. This is the default, and is the stage to use while the new location is being filled.
+	MigrationReadOld MigrationStage = iota
+
+	// MigrationReadNew means that writes go to both the old and the new location, and reads come from
+	// the new one. In this stage, it is still possible to go back to reading from the old location.
+	MigrationReadNew
+
+	// MigrationComplete means that the move is finished: reads and writes use only the new location,
+	// and the old one is no longer changed.
+	MigrationComplete
+)
+
+func (s MigrationStage) String() string {
+	switch s {
+	case MigrationReadOld:
+		return "read old"
+	case MigrationReadNew:
+		return "read new"
+	case MigrationComplete:
+		return "complete"
+	default:
+		return fmt.Sprintf("MigrationStage(%d)", int(s))
+	}
+}
+
+// MigrationBuilder is a builder for a data store that moves data from one DynamoDB location to
+// another. Use [MigrationDataStore] to create it.
+//
+// Like [StoreBuilder], it can be passed to
+// [github.com/launchdarkly/go-server-sdk/v7/ldcomponents.PersistentDataStore]:
+//
+//	config.DataStore = ldcomponents.PersistentDataStore(
+//		lddynamodb.MigrationDataStore(
+//			lddynamodb.DataStore("old-table"),
+//			lddynamodb.DataStore("new-table"),
+//		).Stage(lddynamodb.MigrationReadOld).ShadowReads(),
+//	)
+type MigrationBuilder struct {
+	oldStore    *StoreBuilder[subsystems.PersistentDataStore]
+	newStore    *StoreBuilder[subsystems.PersistentDataStore]
+	stage       MigrationStage
+	shadowReads bool
+}
+
+// MigrationController is implemented by the data store that is created by [MigrationDataStore], so
+// that an application can move to the next stage of a migration without restarting.
+type MigrationController interface {
+	// MigrationStage returns the current stage.
+	MigrationStage() MigrationStage
+	// SetMigrationStage changes the stage. Setting it to [MigrationComplete] is the final cutover.
+	SetMigrationStage(stage MigrationStage)
+	// ShadowReadMismatches returns the number of times that a shadow read found that the two
+	// locations disagreed about an item, since the store was created. See [MigrationBuilder.ShadowReads].
+	ShadowReadMismatches() int
+}
+
+// MigrationDataStore returns a builder for a data store that writes to two DynamoDB locations, such
+// as two tables, or two prefixes in the same table, so that data can be moved from the old one to the
+// new one without downtime.
+//
+// While the migration is in the [MigrationReadOld] or [MigrationReadNew] stage, every Init and Upsert
+// is applied to both locations at once, each with the usual version checks; if either write fails,
+// the store returns an error. Once the new location has
+// been initialized and reads from it have been verified, for instance with
+// [MigrationBuilder.ShadowReads], the stage can be changed to [MigrationComplete].
+func MigrationDataStore(
+	oldStore *StoreBuilder[subsystems.PersistentDataStore],
+	newStore *StoreBuilder[subsystems.PersistentDataStore],
+) *MigrationBuilder {
+	return &MigrationBuilder{oldStore: oldStore, newStore: newStore}
+}
+
+// Stage specifies the initial stage of the migration. The default is [MigrationReadOld]. The stage
+// can be changed later with [MigrationController].
+func (b *MigrationBuilder) Stage(stage MigrationStage) *MigrationBuilder {
+	b.stage = stage
+	return b
+}
+
+// ShadowReads makes the store read from both locations while both are being written, and log a
+// warning when they disagree about an item. It still returns only the results from the location that
+// the current stage reads from. This doubles the number of reads.
+//
+// To keep the log from being flooded when the same items are read repeatedly, a mismatch for an item
+// is only logged again if it changes, or if the item has matched in between. Every mismatch is
+// counted; see [MigrationController].
+func (b *MigrationBuilder) ShadowReads() *MigrationBuilder {
+	b.shadowReads = true
+	return b
+}
+
+// Build is called internally by the SDK.
+func (b *MigrationBuilder) Build(context subsystems.ClientContext) (subsystems.PersistentDataStore, error) {
+	return newMigrationDataStore(b, context)
+}
+
+// DescribeConfiguration is used internally by the SDK to inspect the configuration.
+func (b *MigrationBuilder) DescribeConfiguration() ldvalue.Value {
+	return describeMultiStore()
+}
+
+// Internal type for a data store that migrates data from one DynamoDB location to another.
+type migrationDataStore struct {
+	members     *multiStore
+	oldStore    subsystems.PersistentDataStore
+	newStore    subsystems.PersistentDataStore
+	shadowReads bool
+	loggers     ldlog.Loggers
+	lock        sync.RWMutex
+	stage       MigrationStage
+
+	mismatchLock     sync.Mutex
+	mismatches       int
+	loggedMismatches map[string]string // the last mismatch message that was logged for each item
+}
+
+func newMigrationDataStore(builder *MigrationBuilder, context subsystems.ClientContext) (*migrationDataStore, error) {
+	if builder.oldStore == nil || builder.newStore == nil {
+		return nil, errors.New("both the old and the new data store are required")
+	}
+	members, err := buildMultiStore([]storeConfig{
+		{name: "old", configurer: builder.oldStore},
+		{name: "new", configurer: builder.newStore},
+	}, context)
+	if err != nil {
+		return nil, err
+	}
+	store := &migrationDataStore{
+		members:          members,
+		oldStore:         members.stores[0],
+		newStore:         members.stores[1],
+		shadowReads:      builder.shadowReads,
+		loggers:          context.GetLogging().Loggers, // copied by value so we can modify it
+		stage:            builder.stage,
+		loggedMismatches: make(map[string]string),
+	}
+	store.loggers.SetPrefix("DynamoDBMigrationDataStore:")
+	store.loggers.Infof("Migration stage is %q", store.stage)
+	return store, nil
+}
+
+func (store *migrationDataStore) MigrationStage() MigrationStage {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.stage
+}
+
+func (store *migrationDataStore) SetMigrationStage(stage MigrationStage) {
+	store.lock.Lock()
+	oldStage := store.stage
+	store.stage = stage
+	store.lock.Unlock()
+	if stage != oldStage {
+		store.loggers.Infof("Migration stage changed from %q to %q", oldStage, stage)
+	}
+}
+
+func (store *migrationDataStore) ShadowReadMismatches() int {
+	store.mismatchLock.Lock()
+	defer store.mismatchLock.Unlock()
+	return store.mismatches
+}
+
+// stores returns the store to read from, and the other store that should also be written to, if any.
+func (store *migrationDataStore) stores() (primary, secondary subsystems.PersistentDataStore) {
+	switch store.MigrationStage() {
+	case MigrationReadNew:
+		return store.newStore, store.oldStore
+	case MigrationComplete:
+		return store.newStore, nil
+	default:
+		return store.oldStore, store.newStore
+	}
+}
+
+func (store *migrationDataStore) Init(allData []ldstoretypes.SerializedCollection) error {
+	_, err := store.write("initialize", func(s subsystems.PersistentDataStore) (bool, error) {
+		return false, s.Init(allData)
+	})
+	return err
+}
+
+func (store *migrationDataStore) Get(
+	kind ldstoretypes.DataKind,
+	key string,
+) (ldstoretypes.SerializedItemDescriptor, error) {
+	primary, secondary := store.stores()
+	if secondary == nil || !store.shadowReads {
+		return primary.Get(kind, key)
+	}
+	var item, shadowItem ldstoretypes.SerializedItemDescriptor
+	var err, shadowErr error
+	fanOut(2, func(i int) {
+		if i == 0 {
+			item, err = primary.Get(kind, key)
+		} else {
+			shadowItem, shadowErr = secondary.Get(kind, key)
+		}
+	})
+	if err == nil && shadowErr == nil {
+		store.compareItems(kind, key, item, shadowItem)
+	}
+	return item, err
+}
+
+func (store *migrationDataStore) GetAll(
+	kind ldstoretypes.DataKind,
+) ([]ldstoretypes.KeyedSerializedItemDescriptor, error) {
+	primary, secondary := store.stores()
+	if secondary == nil || !store.shadowReads {
+		return primary.GetAll(kind)
+	}
+	var items, shadowItems []ldstoretypes.KeyedSerializedItemDescriptor
+	var err, shadowErr error
+	fanOut(2, func(i int) {
+		if i == 0 {
+			items, err = primary.GetAll(kind)
+		} else {
+			shadowItems, shadowErr = secondary.GetAll(kind)
+		}
+	})
+	if err == nil && shadowErr == nil {
+		shadowByKey := make(map[string]ldstoretypes.SerializedItemDescriptor, len(shadowItems))
+		for _, item := range shadowItems {
+			shadowByKey[item.Key] = item.Item
+		}
+		for _, item := range items {
+			shadowItem, ok := shadowByKey[item.Key]
+			if !ok {
+				shadowItem = ldstoretypes.SerializedItemDescriptor{}.NotFound()
+			}
+			store.compareItems(kind, item.Key, item.Item, shadowItem)
+			delete(shadowByKey, item.Key)
+		}
+		for key, shadowItem := range shadowByKey {
+			store.compareItems(kind, key, ldstoretypes.SerializedItemDescriptor{}.NotFound(), shadowItem)
+		}
+	}
+	return items, err
+}
+
+// compareItems counts a mismatch if the two locations have different versions or content for an
+// item, and logs a warning unless the same mismatch was the last one that was logged for the item.
+func (store *migrationDataStore) compareItems(
+	kind ldstoretypes.DataKind,
+	key string,
+	item, shadowItem ldstoretypes.SerializedItemDescriptor,
+) {
+	itemID := kind.GetName() + "\x00" + key
+	if item.Version == shadowItem.Version && bytes.Equal(item.SerializedItem, shadowItem.SerializedItem) {
+		store.mismatchLock.Lock()
+		delete(store.loggedMismatches, itemID)
+		store.mismatchLock.Unlock()
+		return
+	}
+	var message string
+	if item.Version == shadowItem.Version {
+		message = fmt.Sprintf("Shadow read mismatch for %s key %s: both data stores have version %d, but with"+
+			" different content", kind, key, item.Version)
+	} else {
+		message = fmt.Sprintf("Shadow read mismatch for %s key %s: data store being read has version %d, other"+
+			" data store has version %d", kind, key, item.Version, shadowItem.Version)
+	}
+	store.mismatchLock.Lock()
+	store.mismatches++
+	alreadyLogged := store.loggedMismatches[itemID] == message
+	store.loggedMismatches[itemID] = message
+	store.mismatchLock.Unlock()
+	if !alreadyLogged {
+		store.loggers.Warn(message)
+	}
+}
+
+func (store *migrationDataStore) Upsert(
+	kind ldstoretypes.DataKind,
+	key string,
+	newItem ldstoretypes.SerializedItemDescriptor,
+) (bool, error) {
+	// The other location may not have the same versions yet, for instance if it has not been
+	// initialized, so its result does not change what we report to the SDK.
+	return store.write("update", func(s subsystems.PersistentDataStore) (bool, error) {
+		return s.Upsert(kind, key, newItem)
+	})
+}
+
+// write applies a write to the location that is being read, and to the other one if it is still being
+// written, at the same time. It returns the result from the location that is being read.
+func (store *migrationDataStore) write(
+	description string,
+	apply func(subsystems.PersistentDataStore) (bool, error),
+) (bool, error) {
+	primary, secondary := store.stores()
+	targets := []subsystems.PersistentDataStore{primary}
+	if secondary != nil {
+		targets = append(targets, secondary)
+	}
+	updated := make([]bool, len(targets))
+	errs := make([]error, len(targets))
+	fanOut(len(targets), func(i int) {
+		updated[i], errs[i] = apply(targets[i])
+	})
+	if errs[0] != nil {
+		return false, errs[0]
+	}
+	if len(errs) > 1 && errs[1] != nil {
+		return updated[0], fmt.Errorf("failed to %s the other data store during migration: %w", description, errs[1])
+	}
+	return updated[0], nil
+}
+
+func (store *migrationDataStore) IsInitialized() bool {
+	primary, _ := store.stores()
+	return primary.IsInitialized()
+}
+
+func (store *migrationDataStore) IsStoreAvailable() bool {
+	// Since writes go to both locations until the migration is complete, the store is not fully
+	// usable unless both are available.
+	primary, secondary := store.stores()
+	return primary.IsStoreAvailable() && (secondary == nil || secondary.IsStoreAvailable())
+}
+
+func (store *migrationDataStore) Close() error {
+	return store.members.close()
+}
@@ -0,0 +1,143 @@
+package lddynamodb
+
+import (
+	"testing"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+	"github.com/launchdarkly/go-sdk-common/v3/ldlogtest"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationDataStore(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	item := func(version int) ldstoretypes.SerializedItemDescriptor {
+		return ldstoretypes.SerializedItemDescriptor{Version: version, SerializedItem: []byte(`{}`)}
+	}
+	allData := []ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{{Key: "flag1", Item: item(1)}}},
+	}
+	clearData := func(t *testing.T) {
+		require.NoError(t, clearTestData("old"))
+		require.NoError(t, clearTestData("new"))
+	}
+	build := func(t *testing.T, builder *MigrationBuilder) (*migrationDataStore, *ldlogtest.MockLog) {
+		mockLog := ldlogtest.NewMockLog()
+		ctx := subsystems.BasicClientContext{}
+		ctx.Logging.Loggers = mockLog.Loggers
+		store, err := builder.Build(ctx)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store.(*migrationDataStore), mockLog
+	}
+	makeBuilder := func() *MigrationBuilder {
+		return MigrationDataStore(baseDataStoreBuilder().Prefix("old"), baseDataStoreBuilder().Prefix("new"))
+	}
+	getVersion := func(t *testing.T, store subsystems.PersistentDataStore) int {
+		result, err := store.Get(ldstoreimpl.Features(), "flag1")
+		require.NoError(t, err)
+		return result.Version
+	}
+
+	t.Run("writes go to both locations until cutover", func(t *testing.T) {
+		clearData(t)
+		store, _ := build(t, makeBuilder())
+		assert.Equal(t, MigrationReadOld, store.MigrationStage())
+
+		require.NoError(t, store.Init(allData))
+		assert.True(t, store.IsInitialized())
+		assert.True(t, store.IsStoreAvailable())
+		assert.Equal(t, 1, getVersion(t, store.oldStore))
+		assert.Equal(t, 1, getVersion(t, store.newStore))
+
+		updated, err := store.Upsert(ldstoreimpl.Features(), "flag1", item(2))
+		require.NoError(t, err)
+		assert.True(t, updated)
+		assert.Equal(t, 2, getVersion(t, store.oldStore))
+		assert.Equal(t, 2, getVersion(t, store.newStore))
+
+		store.SetMigrationStage(MigrationComplete)
+		updated, err = store.Upsert(ldstoreimpl.Features(), "flag1", item(3))
+		require.NoError(t, err)
+		assert.True(t, updated)
+		assert.Equal(t, 2, getVersion(t, store.oldStore))
+		assert.Equal(t, 3, getVersion(t, store.newStore))
+		assert.Equal(t, 3, getVersion(t, store))
+	})
+
+	t.Run("reads come from the location for the current stage", func(t *testing.T) {
+		clearData(t)
+		store, _ := build(t, makeBuilder())
+		require.NoError(t, store.Init(allData))
+		_, err := store.newStore.Upsert(ldstoreimpl.Features(), "flag1", item(5))
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, getVersion(t, store))
+		store.SetMigrationStage(MigrationReadNew)
+		assert.Equal(t, 5, getVersion(t, store))
+		store.SetMigrationStage(MigrationReadOld)
+		assert.Equal(t, 1, getVersion(t, store))
+
+		newStore, _ := build(t, makeBuilder().Stage(MigrationReadNew))
+		assert.Equal(t, 5, getVersion(t, newStore))
+	})
+
+	t.Run("shadow reads log mismatches", func(t *testing.T) {
+		clearData(t)
+		store, mockLog := build(t, makeBuilder().ShadowReads())
+		require.NoError(t, store.Init(allData))
+
+		assert.Equal(t, 1, getVersion(t, store))
+		_, err := store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.Len(t, mockLog.GetOutput(ldlog.Warn), 0)
+
+		_, err = store.newStore.Upsert(ldstoreimpl.Features(), "flag1", item(5))
+		require.NoError(t, err)
+		_, err = store.newStore.Upsert(ldstoreimpl.Features(), "flag2", item(1))
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, getVersion(t, store))
+		mockLog.AssertMessageMatch(t, true, ldlog.Warn,
+			"mismatch for features key flag1: data store being read has version 1, other data store has version 5")
+
+		items, err := store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.Len(t, items, 1)
+		mockLog.AssertMessageMatch(t, true, ldlog.Warn,
+			"mismatch for features key flag2: data store being read has version -1, other data store has version 1")
+		assert.Equal(t, 3, store.ShadowReadMismatches())
+	})
+
+	t.Run("shadow reads log the same mismatch only once", func(t *testing.T) {
+		clearData(t)
+		store, mockLog := build(t, makeBuilder().ShadowReads())
+		require.NoError(t, store.Init(allData))
+		_, err := store.newStore.Upsert(ldstoreimpl.Features(), "flag1", item(5))
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, 1, getVersion(t, store))
+		}
+		assert.Len(t, mockLog.GetOutput(ldlog.Warn), 1)
+		assert.Equal(t, 3, store.ShadowReadMismatches())
+
+		_, err = store.newStore.Upsert(ldstoreimpl.Features(), "flag1", item(6))
+		require.NoError(t, err)
+		assert.Equal(t, 1, getVersion(t, store))
+		assert.Len(t, mockLog.GetOutput(ldlog.Warn), 2) // a different mismatch is logged
+
+		_, err = store.oldStore.Upsert(ldstoreimpl.Features(), "flag1", item(6))
+		require.NoError(t, err)
+		assert.Equal(t, 6, getVersion(t, store)) // now they match
+		_, err = store.newStore.Upsert(ldstoreimpl.Features(), "flag1", item(7))
+		require.NoError(t, err)
+		assert.Equal(t, 6, getVersion(t, store))
+		assert.Len(t, mockLog.GetOutput(ldlog.Warn), 3) // logged again after the item matched
+	})
+}
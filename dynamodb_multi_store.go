@@ -0,0 +1,86 @@
+package lddynamodb
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldvalue"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+)
+
+// The data stores created by ReplicatedDataStore and MigrationDataStore are each made of several
+// other data stores. This file contains what they have in common.
+
+// storeConfig is the configuration of one of the data stores that a combined data store is made of.
+// The name identifies it in errors and log messages.
+type storeConfig struct {
+	name       string
+	configurer subsystems.ComponentConfigurer[subsystems.PersistentDataStore]
+}
+
+// multiStore is a set of data stores that are built and closed together.
+type multiStore struct {
+	names  []string
+	stores []subsystems.PersistentDataStore
+}
+
+// describeMultiStore returns the DescribeConfiguration result for the builder of a combined data
+// store, which is the same as for a single data store.
+func describeMultiStore() ldvalue.Value {
+	return ldvalue.String("DynamoDB")
+}
+
+// buildMultiStore builds each of the configured data stores. If any of them fails, the ones that were
+// already built are closed.
+func buildMultiStore(configs []storeConfig, context subsystems.ClientContext) (*multiStore, error) {
+	names := make(map[string]bool)
+	for _, c := range configs {
+		if names[c.name] {
+			return nil, fmt.Errorf("data store name %q is used more than once", c.name)
+		}
+		if c.configurer == nil {
+			return nil, fmt.Errorf("%q data store has no configuration", c.name)
+		}
+		names[c.name] = true
+	}
+	m := &multiStore{}
+	for _, c := range configs {
+		s, err := c.configurer.Build(context)
+		if err != nil {
+			_ = m.close()
+			return nil, fmt.Errorf("failed to create %q data store: %w", c.name, err)
+		}
+		m.names = append(m.names, c.name)
+		m.stores = append(m.stores, s)
+	}
+	return m, nil
+}
+
+// close closes all of the data stores, and returns the first error if any of them failed.
+func (m *multiStore) close() error {
+	var firstErr error
+	for i, s := range m.stores {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close %q data store: %w", m.names[i], err)
+		}
+	}
+	return firstErr
+}
+
+// fanOut calls fn for each index from 0 to count-1 at the same time, and waits for all of the calls to
+// return. Each call should store its result in its own element of a slice.
+func fanOut(count int, fn func(i int)) {
+	if count == 1 {
+		fn(0)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
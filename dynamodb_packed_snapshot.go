@@ -0,0 +1,322 @@
+package lddynamodb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// A packed snapshot is a compressed copy of the whole data set that Init writes to a few items in
+// the "$snapshot" partition of the primary table, so that GetAll can read it with a handful of
+// requests instead of querying every item of a kind (see StoreBuilder.PackedSnapshot).
+//
+// The partition contains a header item, whose sort key is the same as its partition key, and the
+// chunks of gzipped JSON, whose sort keys are the snapshot ID followed by the chunk number. The
+// header says which snapshot is current, how many chunks it has, and whether it is stale.
+//
+// To keep readers from using a snapshot that is missing a change, Upsert marks the header as stale
+// before it updates an item, so that if marking it fails the item is not updated either. Init
+// records its snapshot ID in the header's "refreshing" attribute before it starts writing, which
+// marking the header as stale removes; at the end, it replaces the header only if that attribute
+// still has its ID, so if an item was updated while Init was running, the snapshot is left stale
+// rather than published without the change.
+const (
+	packedSnapshotIDAttr         = "snapshotId"
+	packedSnapshotChunksAttr     = "chunks"
+	packedSnapshotStaleAttr      = "stale"
+	packedSnapshotRefreshingAttr = "refreshing"
+	packedSnapshotCreatedAttr    = "createdOn"
+	packedSnapshotDataAttr       = "data"
+
+	// Each chunk holds at most this many bytes of compressed data, so it is well within the DynamoDB
+	// item size limit.
+	packedSnapshotChunkSize = 256 * 1024
+)
+
+func (store *dynamoDBDataStore) packedSnapshotKey() string {
+	return store.prefixedNamespace("$snapshot")
+}
+
+func (store *dynamoDBDataStore) packedSnapshotHeaderKey() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		tablePartitionKey: attrValueOfString(store.packedSnapshotKey()),
+		tableSortKey:      attrValueOfString(store.packedSnapshotKey()),
+	}
+}
+
+func (store *dynamoDBDataStore) packedSnapshotChunkKey(snapshotID string, index int) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		tablePartitionKey: attrValueOfString(store.packedSnapshotKey()),
+		tableSortKey:      attrValueOfString(fmt.Sprintf("%s:%04d", snapshotID, index)),
+	}
+}
+
+// beginPackedSnapshot records that an Init that will write the specified snapshot is starting.
+func (store *dynamoDBDataStore) beginPackedSnapshot(ctx context.Context, snapshotID string) error {
+	if err := store.writeLimiter.wait(ctx, 1); err != nil {
+		return err // COVERAGE: can't cause this in unit tests
+	}
+	_, err := store.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(store.table),
+		Key:                      store.packedSnapshotHeaderKey(),
+		UpdateExpression:         aws.String("SET #refreshing = :id"),
+		ExpressionAttributeNames: map[string]string{"#refreshing": packedSnapshotRefreshingAttr},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": attrValueOfString(snapshotID),
+		},
+	}, store.apiOptions...)
+	return err
+}
+
+// markPackedSnapshotStale tells readers not to use the current packed snapshot, if there is one.
+func (store *dynamoDBDataStore) markPackedSnapshotStale(ctx context.Context) error {
+	if err := store.writeLimiter.wait(ctx, 1); err != nil {
+		return err // COVERAGE: can't cause this in unit tests
+	}
+	_, err := store.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(store.table),
+		Key:                 store.packedSnapshotHeaderKey(),
+		UpdateExpression:    aws.String("SET #stale = :stale REMOVE #refreshing"),
+		ConditionExpression: aws.String("attribute_exists(#namespace)"),
+		ExpressionAttributeNames: map[string]string{
+			"#namespace":  tablePartitionKey,
+			"#stale":      packedSnapshotStaleAttr,
+			"#refreshing": packedSnapshotRefreshingAttr,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":stale": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	}, store.apiOptions...)
+	var condCheckErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condCheckErr) {
+		return nil // there is no snapshot yet
+	}
+	return err
+}
+
+// writePackedSnapshot writes the data that Init has just stored as a new packed snapshot, and then
+// deletes the chunks of any older snapshot.
+func (store *dynamoDBDataStore) writePackedSnapshot(
+	ctx context.Context,
+	snapshotID string,
+	allData []ldstoretypes.SerializedCollection,
+	work *initWork,
+) error {
+	if len(work.plan.Skip) > 0 {
+		// The table kept newer versions of some items than the ones in allData, so a snapshot of
+		// allData would not match it.
+		store.loggers.Infof("Not writing a packed snapshot, because %d item(s) were not replaced during Init",
+			len(work.plan.Skip))
+		return store.markPackedSnapshotStale(ctx)
+	}
+	tooLarge := make(map[string]map[string]bool)
+	for _, item := range work.plan.TooLarge {
+		if tooLarge[item.Kind] == nil {
+			tooLarge[item.Kind] = make(map[string]bool)
+		}
+		tooLarge[item.Kind][item.Key] = true
+	}
+	kinds := make(map[string][]ldstoretypes.KeyedSerializedItemDescriptor, len(allData))
+	for _, coll := range allData {
+		kindName := coll.Kind.GetName()
+		items := make([]ldstoretypes.KeyedSerializedItemDescriptor, 0, len(coll.Items))
+		for _, item := range coll.Items {
+			if !tooLarge[kindName][item.Key] {
+				items = append(items, item)
+			}
+		}
+		kinds[kindName] = items
+	}
+	encoded, err := encodeSnapshotData(kinds, time.Now())
+	if err != nil {
+		return err // COVERAGE: can't cause this in unit tests
+	}
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write(encoded) // writing to a bytes.Buffer can't fail
+	_ = zw.Close()
+
+	numChunks := 0
+	for data := compressed.Bytes(); len(data) > 0; numChunks++ {
+		chunk := data
+		if len(chunk) > packedSnapshotChunkSize {
+			chunk = chunk[:packedSnapshotChunkSize]
+		}
+		data = data[len(chunk):]
+		item := store.packedSnapshotChunkKey(snapshotID, numChunks)
+		item[packedSnapshotDataAttr] = &types.AttributeValueMemberB{Value: chunk}
+		if err := store.writeLimiter.wait(ctx, writeCapacityUnits(itemSize(item))); err != nil {
+			return err // COVERAGE: can't cause this in unit tests
+		}
+		if _, err := store.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(store.table),
+			Item:      item,
+		}, store.apiOptions...); err != nil {
+			return err
+		}
+	}
+
+	header := store.packedSnapshotHeaderKey()
+	header[packedSnapshotIDAttr] = attrValueOfString(snapshotID)
+	header[packedSnapshotChunksAttr] = attrValueOfInt(numChunks)
+	header[packedSnapshotStaleAttr] = &types.AttributeValueMemberBOOL{Value: false}
+	header[packedSnapshotCreatedAttr] = attrValueOfUint64(uint64(time.Now().UnixMilli()))
+	if err := store.writeLimiter.wait(ctx, 1); err != nil {
+		return err // COVERAGE: can't cause this in unit tests
+	}
+	_, err = store.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                aws.String(store.table),
+		Item:                     header,
+		ConditionExpression:      aws.String("#refreshing = :id"),
+		ExpressionAttributeNames: map[string]string{"#refreshing": packedSnapshotRefreshingAttr},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": attrValueOfString(snapshotID),
+		},
+	}, store.apiOptions...)
+	var condCheckErr *types.ConditionalCheckFailedException
+	if errors.As(err, &condCheckErr) {
+		store.loggers.Info("Not publishing the packed snapshot, because data was changed while Init was running")
+		return store.deletePackedSnapshotChunks(ctx, snapshotID, false)
+	}
+	if err != nil {
+		return err
+	}
+	store.loggers.Infof("Wrote packed snapshot of %d byte(s) in %d chunk(s)", compressed.Len(), numChunks)
+	return store.deletePackedSnapshotChunks(ctx, snapshotID, true)
+}
+
+// deletePackedSnapshotChunks deletes the chunks of the specified snapshot, or, if keep is true, the
+// chunks of every snapshot except that one.
+func (store *dynamoDBDataStore) deletePackedSnapshotChunks(ctx context.Context, snapshotID string, keep bool) error {
+	query := &dynamodb.QueryInput{
+		TableName:                aws.String(store.table),
+		ConsistentRead:           aws.Bool(true),
+		ProjectionExpression:     aws.String("#namespace, #key"),
+		ExpressionAttributeNames: map[string]string{"#namespace": tablePartitionKey, "#key": tableSortKey},
+		ReturnConsumedCapacity:   types.ReturnConsumedCapacityTotal,
+		KeyConditions: map[string]types.Condition{
+			tablePartitionKey: {
+				ComparisonOperator: types.ComparisonOperatorEq,
+				AttributeValueList: []types.AttributeValue{attrValueOfString(store.packedSnapshotKey())},
+			},
+		},
+	}
+	for paginator := dynamodb.NewQueryPaginator(store.client, query); paginator.HasMorePages(); {
+		if err := store.readLimiter.wait(ctx, 1); err != nil {
+			return err // COVERAGE: can't cause this in unit tests
+		}
+		out, err := paginator.NextPage(ctx, store.apiOptions...)
+		if err != nil {
+			return err
+		}
+		store.readLimiter.charge(consumedReadCapacityUnits(out, queryReadCapacityUnits(out.Items)) - 1)
+		for _, item := range out.Items {
+			key := attrValueToString(item[tableSortKey])
+			if key == store.packedSnapshotKey() || strings.HasPrefix(key, snapshotID+":") == keep {
+				continue
+			}
+			if err := store.writeLimiter.wait(ctx, 1); err != nil {
+				return err // COVERAGE: can't cause this in unit tests
+			}
+			if _, err := store.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName: aws.String(store.table),
+				Key:       item,
+			}, store.apiOptions...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readPackedSnapshot returns the items of one kind from the current packed snapshot. It returns
+// false if there is no usable snapshot, in which case the caller should query the items instead.
+// The decoded snapshot is kept in memory until a new one is written, so that reading each kind does
+// not mean reading the whole snapshot again.
+func (store *dynamoDBDataStore) readPackedSnapshot(
+	ctx context.Context,
+	kind ldstoretypes.DataKind,
+) ([]ldstoretypes.KeyedSerializedItemDescriptor, bool) {
+	if !store.readLimiter.tryTake(1) {
+		return nil, false
+	}
+	out, err := store.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(store.table),
+		ConsistentRead: aws.Bool(true),
+		Key:            store.packedSnapshotHeaderKey(),
+	}, store.apiOptions...)
+	if err != nil {
+		return nil, false
+	}
+	store.readLimiter.charge(readCapacityUnits(itemSize(out.Item)) - 1)
+	snapshotID := attrValueToString(out.Item[packedSnapshotIDAttr])
+	if stale, ok := out.Item[packedSnapshotStaleAttr].(*types.AttributeValueMemberBOOL); snapshotID == "" ||
+		!ok || stale.Value {
+		return nil, false
+	}
+
+	store.lock.Lock()
+	cachedID, kinds := store.packedSnapshotID, store.packedSnapshotKinds
+	store.lock.Unlock()
+	if cachedID != snapshotID {
+		kinds, err = store.readPackedSnapshotChunks(ctx, snapshotID, attrValueToInt(out.Item[packedSnapshotChunksAttr]))
+		if err != nil {
+			// This can happen if a new snapshot replaced this one while we were reading it.
+			store.loggers.Infof("Unable to read packed snapshot %s, so reading items instead: %s", snapshotID, err)
+			return nil, false
+		}
+		store.lock.Lock()
+		store.packedSnapshotID, store.packedSnapshotKinds = snapshotID, kinds
+		store.lock.Unlock()
+	}
+	items, ok := kinds[kind.GetName()]
+	return items, ok
+}
+
+func (store *dynamoDBDataStore) readPackedSnapshotChunks(
+	ctx context.Context,
+	snapshotID string,
+	numChunks int,
+) (map[string][]ldstoretypes.KeyedSerializedItemDescriptor, error) {
+	var compressed []byte
+	for i := 0; i < numChunks; i++ {
+		if !store.readLimiter.tryTake(1) {
+			return nil, errReadCapacityExceeded
+		}
+		out, err := store.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(store.table),
+			ConsistentRead: aws.Bool(true),
+			Key:            store.packedSnapshotChunkKey(snapshotID, i),
+		}, store.apiOptions...)
+		if err != nil {
+			return nil, err
+		}
+		store.readLimiter.charge(readCapacityUnits(itemSize(out.Item)) - 1)
+		data, ok := out.Item[packedSnapshotDataAttr].(*types.AttributeValueMemberB)
+		if !ok {
+			return nil, fmt.Errorf("chunk %d is missing", i)
+		}
+		compressed = append(compressed, data.Value...)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err // COVERAGE: can't cause this in unit tests
+	}
+	kinds, _, err := decodeSnapshotData(encoded)
+	return kinds, err
+}
@@ -0,0 +1,197 @@
+package lddynamodb
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataStorePackedSnapshot(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	makeItem := func(key string, version int) ldstoretypes.KeyedSerializedItemDescriptor {
+		return ldstoretypes.KeyedSerializedItemDescriptor{Key: key, Item: ldstoretypes.SerializedItemDescriptor{
+			Version: version, SerializedItem: []byte(fmt.Sprintf(`{"key":%q,"version":%d}`, key, version)),
+		}}
+	}
+	data := []ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+			makeItem("flag1", 1), makeItem("flag2", 1),
+		}},
+		{Kind: ldstoreimpl.Segments(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+			makeItem("segment1", 1),
+		}},
+	}
+
+	makeStore := func(t *testing.T, builder *StoreBuilder[subsystems.PersistentDataStore]) *dynamoDBDataStore {
+		store, err := builder.Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store.(*dynamoDBDataStore)
+	}
+	readHeader := func(t *testing.T, store *dynamoDBDataStore) map[string]types.AttributeValue {
+		out, err := store.client.GetItem(store.context, &dynamodb.GetItemInput{
+			TableName: aws.String(store.table),
+			Key:       store.packedSnapshotHeaderKey(),
+		})
+		require.NoError(t, err)
+		return out.Item
+	}
+	countChunks := func(t *testing.T, store *dynamoDBDataStore) int {
+		out, err := store.client.Query(store.context, &dynamodb.QueryInput{
+			TableName: aws.String(store.table),
+			KeyConditions: map[string]types.Condition{
+				tablePartitionKey: {
+					ComparisonOperator: types.ComparisonOperatorEq,
+					AttributeValueList: []types.AttributeValue{attrValueOfString(store.packedSnapshotKey())},
+				},
+			},
+		})
+		require.NoError(t, err)
+		return len(out.Items) - 1 // not counting the header
+	}
+	// updateWithoutMarkingStale changes an item in the table without going through a store that knows
+	// about the snapshot, so we can tell whether a reader got the item from the snapshot.
+	updateWithoutMarkingStale := func(t *testing.T, item ldstoretypes.KeyedSerializedItemDescriptor) {
+		updated, err := makeStore(t, baseDataStoreBuilder()).Upsert(ldstoreimpl.Features(), item.Key, item.Item)
+		require.NoError(t, err)
+		require.True(t, updated)
+	}
+
+	t.Run("GetAll reads the snapshot written by Init", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store := makeStore(t, baseDataStoreBuilder().PackedSnapshot())
+		require.NoError(t, store.Init(data))
+		assert.Equal(t, 1, countChunks(t, store))
+
+		updateWithoutMarkingStale(t, makeItem("flag1", 2))
+
+		reader := makeStore(t, baseDataStoreBuilder().PackedSnapshot())
+		features, err := reader.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, data[0].Items, features)
+		segments, err := reader.GetAll(ldstoreimpl.Segments())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, data[1].Items, segments)
+
+		// A reader without the option queries the items as usual
+		features, err = makeStore(t, baseDataStoreBuilder()).GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []ldstoretypes.KeyedSerializedItemDescriptor{makeItem("flag1", 2), makeItem("flag2", 1)},
+			features)
+	})
+
+	t.Run("Upsert marks the snapshot as stale", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store := makeStore(t, baseDataStoreBuilder().PackedSnapshot())
+		require.NoError(t, store.Init(data))
+
+		var staleBeforeUpdate types.AttributeValue
+		store.testUpdateHook = func() { staleBeforeUpdate = readHeader(t, store)[packedSnapshotStaleAttr] }
+		updated, err := store.Upsert(ldstoreimpl.Features(), "flag2", makeItem("flag2", 2).Item)
+		store.testUpdateHook = nil
+		require.NoError(t, err)
+		require.True(t, updated)
+		assert.Equal(t, &types.AttributeValueMemberBOOL{Value: true}, staleBeforeUpdate)
+		assert.Equal(t, &types.AttributeValueMemberBOOL{Value: true}, readHeader(t, store)[packedSnapshotStaleAttr])
+
+		features, err := store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []ldstoretypes.KeyedSerializedItemDescriptor{makeItem("flag1", 1), makeItem("flag2", 2)},
+			features)
+
+		// The next Init writes a new snapshot and deletes the old one
+		require.NoError(t, store.Init(data))
+		assert.Equal(t, &types.AttributeValueMemberBOOL{Value: false}, readHeader(t, store)[packedSnapshotStaleAttr])
+		assert.Equal(t, 1, countChunks(t, store))
+		updateWithoutMarkingStale(t, makeItem("flag1", 3))
+		features, err = store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, data[0].Items, features)
+	})
+
+	t.Run("UpsertMany marks the snapshot as stale", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store := makeStore(t, baseDataStoreBuilder().PackedSnapshot())
+		require.NoError(t, store.Init(data))
+
+		result, err := store.UpsertMany([]UpsertItem{
+			{Kind: ldstoreimpl.Features(), Key: "flag1", Item: makeItem("flag1", 2).Item},
+		})
+		require.NoError(t, err)
+		require.Len(t, result.Applied, 1)
+		assert.Equal(t, &types.AttributeValueMemberBOOL{Value: true}, readHeader(t, store)[packedSnapshotStaleAttr])
+	})
+
+	t.Run("snapshot is not published if an item is updated during Init", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		other := makeStore(t, baseDataStoreBuilder().PackedSnapshot())
+		require.NoError(t, other.Init(data))
+
+		updatedDuringInit := false
+		store := makeStore(t, baseDataStoreBuilder().PackedSnapshot().InitProgressHandler(func(p InitProgress) {
+			if p.Phase == InitPhaseDeleting && !updatedDuringInit {
+				updatedDuringInit = true
+				_, err := other.Upsert(ldstoreimpl.Segments(), "segment2", makeItem("segment2", 1).Item)
+				require.NoError(t, err)
+			}
+		}))
+		require.NoError(t, store.Init(data))
+		require.True(t, updatedDuringInit)
+		assert.Equal(t, &types.AttributeValueMemberBOOL{Value: true}, readHeader(t, store)[packedSnapshotStaleAttr])
+		assert.Equal(t, 1, countChunks(t, store)) // the unpublished snapshot's chunks were deleted
+
+		segments, err := store.GetAll(ldstoreimpl.Segments())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []ldstoretypes.KeyedSerializedItemDescriptor{makeItem("segment1", 1),
+			makeItem("segment2", 1)}, segments)
+	})
+
+	t.Run("snapshot cannot be combined with a non-default codec", func(t *testing.T) {
+		codec := ChainedItemCodec(GzipItemTransform())
+		_, err := baseDataStoreBuilder().PackedSnapshot().Codec(codec).Build(subsystems.BasicClientContext{})
+		assert.Error(t, err)
+		_, err = baseDataStoreBuilder().PackedSnapshot().Codec(DefaultItemCodec(), codec).
+			Build(subsystems.BasicClientContext{})
+		assert.Error(t, err)
+
+		store, err := baseDataStoreBuilder().PackedSnapshot().Codec(DefaultItemCodec()).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+	})
+
+	t.Run("large snapshot is split into chunks", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		var items []ldstoretypes.KeyedSerializedItemDescriptor
+		for i := 0; i < 8; i++ {
+			random := make([]byte, 75000) // random data doesn't compress
+			_, _ = rand.Read(random)
+			items = append(items, ldstoretypes.KeyedSerializedItemDescriptor{
+				Key: fmt.Sprintf("flag%d", i), Item: ldstoretypes.SerializedItemDescriptor{
+					Version: 1, SerializedItem: []byte(`"` + base64.StdEncoding.EncodeToString(random) + `"`),
+				},
+			})
+		}
+		largeData := []ldstoretypes.SerializedCollection{{Kind: ldstoreimpl.Features(), Items: items}}
+
+		store := makeStore(t, baseDataStoreBuilder().PackedSnapshot())
+		require.NoError(t, store.Init(largeData))
+		assert.Greater(t, countChunks(t, store), 1)
+
+		features, err := makeStore(t, baseDataStoreBuilder().PackedSnapshot()).GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.ElementsMatch(t, items, features)
+	})
+}
@@ -0,0 +1,170 @@
+package lddynamodb
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// DynamoDB charges one read capacity unit for each 4KB of a strongly consistent read, and one
+	// write capacity unit for each 1KB written.
+	readCapacityUnitSize  = 4 * 1024
+	writeCapacityUnitSize = 1024
+)
+
+// errReadCapacityExceeded is returned when a read is refused because of ReadCapacityLimit.
+var errReadCapacityExceeded = &storeError{kind: ErrThrottled, err: errors.New("read capacity limit exceeded")}
+
+// capacityLimiter is a token bucket that limits the rate at which a store consumes DynamoDB capacity
+// units. A nil *capacityLimiter imposes no limit.
+//
+// The bucket is allowed to go into debt, because the actual cost of a read is not known until it has
+// completed, and the cost of a single large write may be more than the bucket can ever hold. Any debt
+// is paid off by later refills before more capacity becomes available.
+type capacityLimiter struct {
+	lock   sync.Mutex
+	rate   float64 // units per second
+	burst  float64 // maximum units that can accumulate
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newCapacityLimiter(unitsPerSecond, burst float64) *capacityLimiter {
+	if unitsPerSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = math.Max(unitsPerSecond, 1)
+	}
+	return &capacityLimiter{
+		rate:   unitsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// refill adds the tokens that have accrued since the last call. The caller must hold the lock.
+func (l *capacityLimiter) refill() {
+	now := l.now()
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+elapsed.Seconds()*l.rate)
+		l.last = now
+	}
+}
+
+// tryTake consumes the specified number of units if they are available right now, and returns false
+// without consuming anything if they are not.
+func (l *capacityLimiter) tryTake(units float64) bool {
+	if l == nil {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.refill()
+	if l.tokens < math.Min(units, l.burst) {
+		return false
+	}
+	l.tokens -= units
+	return true
+}
+
+// wait consumes the specified number of units, first blocking until they are available or until the
+// context is cancelled. A cost greater than the burst size only has to wait for a full bucket.
+func (l *capacityLimiter) wait(ctx context.Context, units float64) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.lock.Lock()
+		l.refill()
+		needed := math.Min(units, l.burst)
+		if l.tokens >= needed {
+			l.tokens -= units
+			l.lock.Unlock()
+			return nil
+		}
+		delay := time.Duration((needed - l.tokens) / l.rate * float64(time.Second))
+		l.lock.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// charge consumes units unconditionally, for costs that are only known after an operation completed.
+func (l *capacityLimiter) charge(units float64) {
+	if l == nil || units <= 0 {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.refill()
+	l.tokens -= units
+}
+
+// itemSize estimates the number of bytes that DynamoDB counts for an item.
+//
+// see: https://docs.aws.amazon.com/amazondynamodb/latest/developerguide/CapacityUnitCalculations.html
+func itemSize(item map[string]types.AttributeValue) int {
+	size := 100 // fixed overhead for index data
+	for key, value := range item {
+		size += len(key) + attrValueSize(value)
+	}
+	return size
+}
+
+func readCapacityUnits(bytes int) float64 {
+	return math.Max(1, math.Ceil(float64(bytes)/readCapacityUnitSize))
+}
+
+func writeCapacityUnits(bytes int) float64 {
+	return math.Max(1, math.Ceil(float64(bytes)/writeCapacityUnitSize))
+}
+
+// writeRequestCapacityUnits estimates the cost of a batch of writes. The cost of a delete depends on
+// the size of the item being deleted, which we don't know, so we count it as one unit.
+func writeRequestCapacityUnits(requests []types.WriteRequest) float64 {
+	units := 0.0
+	for _, r := range requests {
+		if r.PutRequest != nil {
+			units += writeCapacityUnits(itemSize(r.PutRequest.Item))
+		} else {
+			units++
+		}
+	}
+	return units
+}
+
+// queryReadCapacityUnits estimates the cost of a page of query results. DynamoDB adds up the sizes of
+// all of the items before rounding up, rather than rounding each item.
+func queryReadCapacityUnits(items []map[string]types.AttributeValue) float64 {
+	size := 0
+	for _, item := range items {
+		size += itemSize(item)
+	}
+	return readCapacityUnits(size)
+}
+
+// consumedReadCapacityUnits returns the read capacity units that DynamoDB reported for a successful
+// request, or the estimate if it did not report any. The reported value is preferred because our
+// estimate only sees the attributes that were returned, while DynamoDB charges for the whole item even
+// if the request used a projection.
+func consumedReadCapacityUnits(output interface{}, estimate float64) float64 {
+	if units := consumedCapacityOf(output); units > 0 {
+		return units
+	}
+	return estimate
+}
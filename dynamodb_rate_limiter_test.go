@@ -0,0 +1,148 @@
+package lddynamodb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeTestCapacityLimiter(unitsPerSecond, burst float64) (*capacityLimiter, *time.Time) {
+	l := newCapacityLimiter(unitsPerSecond, burst)
+	now := l.last
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestCapacityLimiter(t *testing.T) {
+	t.Run("nil limiter has no limit", func(t *testing.T) {
+		var l *capacityLimiter
+		assert.Nil(t, newCapacityLimiter(0, 10))
+		assert.True(t, l.tryTake(1000))
+		assert.NoError(t, l.wait(context.Background(), 1000))
+		l.charge(1000)
+	})
+
+	t.Run("burst defaults to rate", func(t *testing.T) {
+		assert.Equal(t, 5.0, newCapacityLimiter(5, 0).burst)
+		assert.Equal(t, 1.0, newCapacityLimiter(0.5, 0).burst)
+		assert.Equal(t, 20.0, newCapacityLimiter(5, 20).burst)
+	})
+
+	t.Run("tryTake fails when capacity is exhausted and succeeds after refill", func(t *testing.T) {
+		l, now := makeTestCapacityLimiter(10, 10)
+		assert.True(t, l.tryTake(6))
+		assert.False(t, l.tryTake(6))
+		assert.True(t, l.tryTake(4))
+		assert.False(t, l.tryTake(1))
+
+		*now = now.Add(500 * time.Millisecond)
+		assert.True(t, l.tryTake(5))
+		assert.False(t, l.tryTake(1))
+
+		*now = now.Add(time.Hour)
+		assert.Equal(t, true, l.tryTake(10))
+		assert.False(t, l.tryTake(1))
+	})
+
+	t.Run("charge can go into debt", func(t *testing.T) {
+		l, now := makeTestCapacityLimiter(10, 10)
+		l.charge(25)
+		*now = now.Add(time.Second)
+		assert.False(t, l.tryTake(1))
+		*now = now.Add(time.Second)
+		assert.True(t, l.tryTake(5))
+	})
+
+	t.Run("cost larger than burst only needs a full bucket", func(t *testing.T) {
+		l, _ := makeTestCapacityLimiter(10, 10)
+		assert.True(t, l.tryTake(100))
+		assert.Equal(t, -90.0, l.tokens)
+	})
+
+	t.Run("wait blocks until capacity is available", func(t *testing.T) {
+		l := newCapacityLimiter(100, 1)
+		require.NoError(t, l.wait(context.Background(), 1))
+		start := time.Now()
+		require.NoError(t, l.wait(context.Background(), 1))
+		assert.GreaterOrEqual(t, time.Since(start), 5*time.Millisecond)
+	})
+
+	t.Run("wait stops if context is cancelled", func(t *testing.T) {
+		l := newCapacityLimiter(0.001, 1)
+		require.NoError(t, l.wait(context.Background(), 1))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Equal(t, context.Canceled, l.wait(ctx, 1))
+	})
+}
+
+func TestCapacityUnitEstimates(t *testing.T) {
+	small := map[string]types.AttributeValue{"a": attrValueOfString("b")}
+	big := map[string]types.AttributeValue{"a": attrValueOfString(strings.Repeat("x", 5000))}
+
+	assert.Equal(t, 102, itemSize(small))
+	assert.Equal(t, 1.0, readCapacityUnits(itemSize(small)))
+	assert.Equal(t, 2.0, readCapacityUnits(itemSize(big)))
+	assert.Equal(t, 1.0, writeCapacityUnits(itemSize(small)))
+	assert.Equal(t, 5.0, writeCapacityUnits(itemSize(big)))
+	assert.Equal(t, 3.0, queryReadCapacityUnits([]map[string]types.AttributeValue{big, big}))
+	assert.Equal(t, 7.0, writeRequestCapacityUnits([]types.WriteRequest{
+		{PutRequest: &types.PutRequest{Item: big}},
+		{PutRequest: &types.PutRequest{Item: small}},
+		{DeleteRequest: &types.DeleteRequest{Key: small}},
+	}))
+
+	reported := &dynamodb.QueryOutput{ConsumedCapacity: &types.ConsumedCapacity{CapacityUnits: aws.Float64(4)}}
+	assert.Equal(t, 4.0, consumedReadCapacityUnits(reported, 1))
+	assert.Equal(t, 1.0, consumedReadCapacityUnits(&dynamodb.QueryOutput{}, 1))
+}
+
+func TestDataStoreReadCapacityLimit(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+	require.NoError(t, clearTestData(""))
+
+	store, err := baseDataStoreBuilder().ReadCapacityLimit(0.01, 2).WriteCapacityLimit(1000, 0).
+		Build(subsystems.BasicClientContext{})
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Init([]ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: nil},
+	}))
+
+	// Init's query used up some of the capacity, so there is only enough left for one more read
+	_, err = store.Get(ldstoreimpl.Features(), "flag1")
+	require.NoError(t, err)
+	_, err = store.Get(ldstoreimpl.Features(), "flag1")
+	assert.True(t, errors.Is(err, errReadCapacityExceeded))
+	_, err = store.GetAll(ldstoreimpl.Features())
+	assert.True(t, errors.Is(err, errReadCapacityExceeded))
+}
+
+func TestDataStoreFailedAvailabilityCheckIsNotCharged(t *testing.T) {
+	options := makeTestOptions()
+	options.EndpointResolver = dynamodb.EndpointResolverFromURL("http://localhost:1", func(e *aws.Endpoint) {
+		e.SigningRegion = "us-east-1"
+	})
+	options.RetryMaxAttempts = 1
+	store, err := DataStore(testTableName).ClientOptions(options).ReadCapacityLimit(0.01, 1).
+		Build(subsystems.BasicClientContext{})
+	require.NoError(t, err)
+	defer store.Close()
+
+	assert.False(t, store.IsStoreAvailable())
+	assert.False(t, store.IsStoreAvailable())
+	assert.True(t, store.(*dynamoDBDataStore).readLimiter.tryTake(1))
+}
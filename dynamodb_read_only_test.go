@@ -0,0 +1,77 @@
+package lddynamodb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataStoreReadOnly(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	makeData := func(version int) []ldstoretypes.SerializedCollection {
+		return []ldstoretypes.SerializedCollection{
+			{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+				{Key: "flag1", Item: ldstoretypes.SerializedItemDescriptor{Version: version, SerializedItem: []byte(`{}`)}},
+			}},
+		}
+	}
+	newItem := ldstoretypes.SerializedItemDescriptor{Version: 3, SerializedItem: []byte(`{}`)}
+
+	makeStore := func(t *testing.T, builder *StoreBuilder[subsystems.PersistentDataStore]) *dynamoDBDataStore {
+		store, err := builder.Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store.(*dynamoDBDataStore)
+	}
+	getVersion := func(t *testing.T, store *dynamoDBDataStore) int {
+		item, err := store.Get(ldstoreimpl.Features(), "flag1")
+		require.NoError(t, err)
+		return item.Version
+	}
+
+	t.Run("writes are ignored", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		require.NoError(t, makeStore(t, baseDataStoreBuilder()).Init(makeData(1)))
+
+		store := makeStore(t, baseDataStoreBuilder().ReadOnly().WriterLease(time.Minute))
+		assert.Nil(t, store.lease)
+		assert.True(t, store.IsStoreAvailable())
+		assert.True(t, store.IsInitialized())
+
+		require.NoError(t, store.Init(makeData(2)))
+		assert.Equal(t, 1, getVersion(t, store))
+
+		updated, err := store.Upsert(ldstoreimpl.Features(), "flag1", newItem)
+		require.NoError(t, err)
+		assert.False(t, updated)
+
+		items := []UpsertItem{{Kind: ldstoreimpl.Features(), Key: "flag1", Item: newItem}}
+		result, err := store.UpsertMany(items)
+		require.NoError(t, err)
+		assert.Equal(t, items, result.Lost)
+		assert.Equal(t, 1, getVersion(t, store))
+	})
+
+	t.Run("writes return errors", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		require.NoError(t, makeStore(t, baseDataStoreBuilder()).Init(makeData(1)))
+
+		store := makeStore(t, baseDataStoreBuilder().ReadOnlyWithErrors())
+		assert.True(t, errors.Is(store.Init(makeData(2)), ErrReadOnly))
+
+		_, err := store.Upsert(ldstoreimpl.Features(), "flag1", newItem)
+		assert.True(t, errors.Is(err, ErrReadOnly))
+
+		_, err = store.UpsertMany([]UpsertItem{{Kind: ldstoreimpl.Features(), Key: "flag1", Item: newItem}})
+		assert.True(t, errors.Is(err, ErrReadOnly))
+		assert.Equal(t, 1, getVersion(t, store))
+	})
+}
@@ -0,0 +1,469 @@
+package lddynamodb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+	"github.com/launchdarkly/go-sdk-common/v3/ldvalue"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+)
+
+// ReplicationMode determines how a replicated data store handles failures to write to its targets.
+// See [ReplicationBuilder.Mode].
+type ReplicationMode int
+
+const (
+	// ReplicationFailAll means that a write fails if it fails for any target. The targets that
+	// succeeded are not rolled back. This is the default.
+	ReplicationFailAll ReplicationMode = iota
+
+	// ReplicationBestEffort means that a write fails only if it fails for the primary target. Writes
+	// that fail for a replica are queued, and retried in the background in the same order until they
+	// succeed; while a replica has queued writes, new writes for it are added to the queue too.
+	ReplicationBestEffort
+
+	// ReplicationMajority means that a write succeeds if it succeeds for the primary target, and for
+	// more than half of all the targets, counting the primary. Since reads come from the primary, a
+	// write that fails for it always fails. Writes that fail for a replica are queued and retried as in
+	// ReplicationBestEffort, whether or not the write as a whole succeeded.
+	ReplicationMajority
+)
+
+const (
+	// DefaultReplicationRetryInterval is the default value for [ReplicationBuilder.RetryInterval].
+	DefaultReplicationRetryInterval = 5 * time.Second
+
+	// DefaultReplicationMaxPendingWrites is the default value for [ReplicationBuilder.MaxPendingWrites].
+	DefaultReplicationMaxPendingWrites = 1000
+
+	replicationPrimaryName = "primary"
+)
+
+// ReplicationBuilder is a builder for a data store that writes to several DynamoDB tables, which may
+// be in different regions, and reads from one of them. Use [ReplicatedDataStore] to create it.
+//
+// Like [StoreBuilder], it can be passed to
+// [github.com/launchdarkly/go-server-sdk/v7/ldcomponents.PersistentDataStore]:
+//
+//	config.DataStore = ldcomponents.PersistentDataStore(
+//		lddynamodb.ReplicatedDataStore(lddynamodb.DataStore("flags")).
+//			Replica("dr", lddynamodb.DataStore("flags").ClientConfig(drRegionConfig)).
+//			Mode(lddynamodb.ReplicationBestEffort),
+//	)
+type ReplicationBuilder struct {
+	primary          subsystems.ComponentConfigurer[subsystems.PersistentDataStore]
+	replicas         []storeConfig
+	mode             ReplicationMode
+	retryInterval    time.Duration
+	maxPendingWrites int
+}
+
+// ReplicationTargetStatus describes the state of one target of a replicated data store. See
+// [ReplicationStatusProvider].
+type ReplicationTargetStatus struct {
+	// Name is "primary" for the primary target, or the name that was given to [ReplicationBuilder.Replica].
+	Name string
+	// Primary is true for the primary target.
+	Primary bool
+	// PendingWrites is the number of writes that are queued to be retried.
+	PendingWrites int
+	// DroppedWrites is the number of queued writes that have been discarded because the queue was full.
+	DroppedWrites int
+	// Lag is how long the oldest queued write has been waiting, or zero if there are none.
+	Lag time.Duration
+	// LastError is the error from the most recent write that failed, if any.
+	LastError error
+	// LastErrorTime is when the most recent write failed, or the zero time if none has failed.
+	LastErrorTime time.Time
+	// LastSuccessTime is when the most recent write succeeded, or the zero time if none has.
+	LastSuccessTime time.Time
+}
+
+// ReplicationStatusProvider is implemented by the data store that is created by
+// [ReplicatedDataStore], for applications that want to monitor whether the replicas are keeping up
+// with the primary.
+type ReplicationStatusProvider interface {
+	// ReplicationStatus returns the status of each target, starting with the primary.
+	ReplicationStatus() []ReplicationTargetStatus
+}
+
+// ReplicatedDataStore returns a builder for a data store that applies every write to the primary
+// store and to each replica that is added with [ReplicationBuilder.Replica], and that reads only from
+// the primary.
+//
+// The primary and replicas are normally configured with [DataStore], but any persistent data store
+// configuration can be used. Each of them is built and closed along with the replicated store.
+func ReplicatedDataStore(
+	primary subsystems.ComponentConfigurer[subsystems.PersistentDataStore],
+) *ReplicationBuilder {
+	return &ReplicationBuilder{
+		primary:          primary,
+		retryInterval:    DefaultReplicationRetryInterval,
+		maxPendingWrites: DefaultReplicationMaxPendingWrites,
+	}
+}
+
+// Replica adds a store that all writes are copied to. The name identifies it in log messages and in
+// [ReplicationStatusProvider]; it must be unique, and cannot be "primary".
+func (b *ReplicationBuilder) Replica(
+	name string,
+	replica subsystems.ComponentConfigurer[subsystems.PersistentDataStore],
+) *ReplicationBuilder {
+	b.replicas = append(b.replicas, storeConfig{name: name, configurer: replica})
+	return b
+}
+
+// Mode specifies how the store handles failures to write to its targets. The default is
+// [ReplicationFailAll].
+func (b *ReplicationBuilder) Mode(mode ReplicationMode) *ReplicationBuilder {
+	b.mode = mode
+	return b
+}
+
+// RetryInterval specifies how often the store retries queued writes in [ReplicationBestEffort] and
+// [ReplicationMajority] modes. The default is [DefaultReplicationRetryInterval].
+func (b *ReplicationBuilder) RetryInterval(interval time.Duration) *ReplicationBuilder {
+	if interval <= 0 {
+		interval = DefaultReplicationRetryInterval
+	}
+	b.retryInterval = interval
+	return b
+}
+
+// MaxPendingWrites specifies how many writes can be queued for each replica in [ReplicationBestEffort]
+// and [ReplicationMajority] modes. If the queue is full, the oldest write is discarded. A write that
+// initializes the store with a full data set replaces everything that was queued before it, so the
+// queue only fills up if a replica misses many individual updates. The default is
+// [DefaultReplicationMaxPendingWrites].
+func (b *ReplicationBuilder) MaxPendingWrites(n int) *ReplicationBuilder {
+	if n < 1 {
+		n = 1
+	}
+	b.maxPendingWrites = n
+	return b
+}
+
+// Build is called internally by the SDK.
+func (b *ReplicationBuilder) Build(context subsystems.ClientContext) (subsystems.PersistentDataStore, error) {
+	return newReplicatedDataStore(b, context)
+}
+
+// DescribeConfiguration is used internally by the SDK to inspect the configuration.
+func (b *ReplicationBuilder) DescribeConfiguration() ldvalue.Value {
+	return describeMultiStore()
+}
+
+// Internal type for a data store that writes to several other data stores.
+type replicatedDataStore struct {
+	members          *multiStore
+	targets          []*replicationTarget // the primary is always first
+	mode             ReplicationMode
+	maxPendingWrites int
+	loggers          ldlog.Loggers
+	closeChan        chan struct{}
+	closeOnce        sync.Once
+	retrierDone      chan struct{}
+}
+
+type replicationTarget struct {
+	name  string
+	store subsystems.PersistentDataStore
+
+	// writeLock ensures that writes to each target, including retries, are applied one at a time in
+	// the order they were made; lock protects the other fields, so that the status can be read
+	// without waiting for a write.
+	writeLock       sync.Mutex
+	lock            sync.Mutex
+	pending         []pendingWrite
+	dropped         int
+	lastError       error
+	lastErrorTime   time.Time
+	lastSuccessTime time.Time
+}
+
+type pendingWrite struct {
+	description string
+	queued      time.Time
+	isInit      bool
+	apply       func(subsystems.PersistentDataStore) (bool, error)
+}
+
+func newReplicatedDataStore(
+	builder *ReplicationBuilder,
+	context subsystems.ClientContext,
+) (*replicatedDataStore, error) {
+	if builder.primary == nil {
+		return nil, errors.New("primary data store is required")
+	}
+	configs := append([]storeConfig{{name: replicationPrimaryName, configurer: builder.primary}}, builder.replicas...)
+	members, err := buildMultiStore(configs, context)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &replicatedDataStore{
+		members:          members,
+		mode:             builder.mode,
+		maxPendingWrites: builder.maxPendingWrites,
+		loggers:          context.GetLogging().Loggers, // copied by value so we can modify it
+		closeChan:        make(chan struct{}),
+		retrierDone:      make(chan struct{}),
+	}
+	store.loggers.SetPrefix("DynamoDBReplicatedDataStore:")
+	for i, s := range members.stores {
+		store.targets = append(store.targets, &replicationTarget{name: members.names[i], store: s})
+	}
+
+	if store.mode == ReplicationBestEffort || store.mode == ReplicationMajority {
+		go store.retryPendingWrites(builder.retryInterval)
+	} else {
+		close(store.retrierDone)
+	}
+	return store, nil
+}
+
+func (store *replicatedDataStore) primary() subsystems.PersistentDataStore {
+	return store.targets[0].store
+}
+
+func (store *replicatedDataStore) Init(allData []ldstoretypes.SerializedCollection) error {
+	_, err := store.write("Init", true, func(s subsystems.PersistentDataStore) (bool, error) {
+		return false, s.Init(allData)
+	})
+	return err
+}
+
+func (store *replicatedDataStore) Get(
+	kind ldstoretypes.DataKind,
+	key string,
+) (ldstoretypes.SerializedItemDescriptor, error) {
+	return store.primary().Get(kind, key)
+}
+
+func (store *replicatedDataStore) GetAll(
+	kind ldstoretypes.DataKind,
+) ([]ldstoretypes.KeyedSerializedItemDescriptor, error) {
+	return store.primary().GetAll(kind)
+}
+
+func (store *replicatedDataStore) Upsert(
+	kind ldstoretypes.DataKind,
+	key string,
+	newItem ldstoretypes.SerializedItemDescriptor,
+) (bool, error) {
+	description := fmt.Sprintf("Upsert of %s key %s version %d", kind, key, newItem.Version)
+	return store.write(description, false, func(s subsystems.PersistentDataStore) (bool, error) {
+		return s.Upsert(kind, key, newItem)
+	})
+}
+
+func (store *replicatedDataStore) IsInitialized() bool {
+	return store.primary().IsInitialized()
+}
+
+func (store *replicatedDataStore) IsStoreAvailable() bool {
+	return store.primary().IsStoreAvailable()
+}
+
+func (store *replicatedDataStore) Close() error {
+	store.closeOnce.Do(func() {
+		close(store.closeChan)
+	})
+	<-store.retrierDone
+	return store.members.close()
+}
+
+func (store *replicatedDataStore) ReplicationStatus() []ReplicationTargetStatus {
+	now := time.Now()
+	ret := make([]ReplicationTargetStatus, 0, len(store.targets))
+	for i, t := range store.targets {
+		t.lock.Lock()
+		status := ReplicationTargetStatus{
+			Name:            t.name,
+			Primary:         i == 0,
+			PendingWrites:   len(t.pending),
+			DroppedWrites:   t.dropped,
+			LastError:       t.lastError,
+			LastErrorTime:   t.lastErrorTime,
+			LastSuccessTime: t.lastSuccessTime,
+		}
+		if len(t.pending) > 0 {
+			status.Lag = now.Sub(t.pending[0].queued)
+		}
+		t.lock.Unlock()
+		ret = append(ret, status)
+	}
+	return ret
+}
+
+// write applies a write to every target at once, and then decides whether it succeeded according to
+// the replication mode. The returned boolean is the primary's result for an Upsert.
+func (store *replicatedDataStore) write(
+	description string,
+	isInit bool,
+	apply func(subsystems.PersistentDataStore) (bool, error),
+) (bool, error) {
+	type result struct {
+		updated bool
+		queued  bool
+		err     error
+	}
+	results := make([]result, len(store.targets))
+	fanOut(len(store.targets), func(i int) {
+		queueIfFailed := store.mode != ReplicationFailAll && i > 0
+		updated, queued, err := store.writeToTarget(store.targets[i], pendingWrite{
+			description: description, queued: time.Now(), isInit: isInit, apply: apply,
+		}, queueIfFailed)
+		results[i] = result{updated, queued, err}
+	})
+
+	var firstErr error
+	failures, applied := 0, 0
+	for i, r := range results {
+		if r.err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s failed for %q data store: %w", description, store.targets[i].name, r.err)
+		}
+		switch {
+		case r.err != nil && !r.queued:
+			failures++
+		case r.err == nil && !r.queued:
+			applied++
+		}
+	}
+	updated := results[0].updated
+	switch store.mode {
+	case ReplicationBestEffort:
+		if results[0].err != nil {
+			return false, firstErr
+		}
+		return updated, nil
+	case ReplicationMajority:
+		if results[0].err != nil {
+			return false, firstErr
+		}
+		if applied*2 > len(results) {
+			if applied < len(results) {
+				store.loggers.Warnf("%s was applied to %d of %d data stores, which is a majority; it will be retried"+
+					" for the others", description, applied, len(results))
+			}
+			return updated, nil
+		}
+		if firstErr == nil {
+			// COVERAGE: only happens if a write is queued behind earlier writes for most replicas, without
+			// failing for any of them
+			firstErr = fmt.Errorf("%s was applied to only %d of %d data stores", description, applied, len(results))
+		}
+		return false, firstErr
+	default:
+		if failures > 0 {
+			return false, firstErr
+		}
+		return updated, nil
+	}
+}
+
+// writeToTarget applies a write to one target, unless that target already has queued writes, in
+// which case the write is queued after them. If queueIfFailed is true, a write that fails is queued
+// to be retried. The queued result is true if the write was queued, and in that case the error is the
+// one that caused it to be queued, if any.
+func (store *replicatedDataStore) writeToTarget(
+	t *replicationTarget,
+	w pendingWrite,
+	queueIfFailed bool,
+) (updated bool, queued bool, err error) {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+
+	t.lock.Lock()
+	hasPending := len(t.pending) > 0
+	t.lock.Unlock()
+	if hasPending {
+		store.enqueue(t, w)
+		return false, true, nil
+	}
+
+	updated, err = w.apply(t.store)
+	t.recordResult(err)
+	if err != nil && queueIfFailed {
+		store.loggers.Warnf("%s failed for %q data store, will retry: %s", w.description, t.name, err)
+		store.enqueue(t, w)
+		return false, true, err
+	}
+	return updated, false, err
+}
+
+// enqueue adds a write to a target's retry queue. The caller must hold the target's writeLock.
+func (store *replicatedDataStore) enqueue(t *replicationTarget, w pendingWrite) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if w.isInit {
+		// A full data set makes every earlier write irrelevant.
+		t.pending = nil
+	}
+	if len(t.pending) >= store.maxPendingWrites {
+		store.loggers.Warnf("Too many writes are queued for %q data store; discarding %s",
+			t.name, t.pending[0].description)
+		t.pending = t.pending[1:]
+		t.dropped++
+	}
+	t.pending = append(t.pending, w)
+}
+
+func (t *replicationTarget) recordResult(err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err != nil {
+		t.lastError, t.lastErrorTime = err, time.Now()
+	} else {
+		t.lastSuccessTime = time.Now()
+	}
+}
+
+func (store *replicatedDataStore) retryPendingWrites(interval time.Duration) {
+	defer close(store.retrierDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-store.closeChan:
+			return
+		case <-ticker.C:
+			for _, t := range store.targets[1:] {
+				store.retryTarget(t)
+			}
+		}
+	}
+}
+
+// retryTarget applies a target's queued writes in order, stopping at the first one that fails.
+func (store *replicatedDataStore) retryTarget(t *replicationTarget) {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	for {
+		t.lock.Lock()
+		if len(t.pending) == 0 {
+			t.lock.Unlock()
+			return
+		}
+		w := t.pending[0]
+		t.lock.Unlock()
+
+		_, err := w.apply(t.store)
+		t.recordResult(err)
+		if err != nil {
+			store.loggers.Debugf("Retry failed (store=%s write=%q error=%s)", t.name, w.description, err)
+			return
+		}
+		t.lock.Lock()
+		t.pending = t.pending[1:]
+		remaining := len(t.pending)
+		t.lock.Unlock()
+		if remaining == 0 {
+			store.loggers.Infof("All queued writes have been applied to %q data store", t.name)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package lddynamodb
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errFakeReplicaFailure = errors.New("sorry")
+
+// flakyStoreConfigurer builds a data store whose writes fail whenever setFailing(true) has been called.
+type flakyStoreConfigurer struct {
+	wrapped subsystems.ComponentConfigurer[subsystems.PersistentDataStore]
+	lock    sync.Mutex
+	failing bool
+}
+
+type flakyStore struct {
+	subsystems.PersistentDataStore
+	owner *flakyStoreConfigurer
+}
+
+func (c *flakyStoreConfigurer) Build(context subsystems.ClientContext) (subsystems.PersistentDataStore, error) {
+	store, err := c.wrapped.Build(context)
+	if err != nil {
+		return nil, err
+	}
+	return flakyStore{PersistentDataStore: store, owner: c}, nil
+}
+
+func (c *flakyStoreConfigurer) setFailing(failing bool) {
+	c.lock.Lock()
+	c.failing = failing
+	c.lock.Unlock()
+}
+
+func (c *flakyStoreConfigurer) isFailing() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.failing
+}
+
+func (s flakyStore) Init(allData []ldstoretypes.SerializedCollection) error {
+	if s.owner.isFailing() {
+		return errFakeReplicaFailure
+	}
+	return s.PersistentDataStore.Init(allData)
+}
+
+func (s flakyStore) Upsert(kind ldstoretypes.DataKind, key string, item ldstoretypes.SerializedItemDescriptor) (
+	bool, error) {
+	if s.owner.isFailing() {
+		return false, errFakeReplicaFailure
+	}
+	return s.PersistentDataStore.Upsert(kind, key, item)
+}
+
+func TestReplicatedDataStore(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+	require.NoError(t, createNamedTableIfNecessary(testSegmentsTableName))
+
+	item := func(version int) ldstoretypes.SerializedItemDescriptor {
+		return ldstoretypes.SerializedItemDescriptor{Version: version, SerializedItem: []byte(`{}`)}
+	}
+	makeData := func(version int) []ldstoretypes.SerializedCollection {
+		return []ldstoretypes.SerializedCollection{
+			{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+				{Key: "flag1", Item: item(version)},
+			}},
+		}
+	}
+	replicaBuilder := func() *StoreBuilder[subsystems.PersistentDataStore] {
+		return DataStore(testSegmentsTableName).ClientOptions(makeTestOptions())
+	}
+	replicaStore := func(t *testing.T) subsystems.PersistentDataStore {
+		store, err := replicaBuilder().Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	}
+	getVersion := func(t *testing.T, store subsystems.PersistentDataStore) int {
+		result, err := store.Get(ldstoreimpl.Features(), "flag1")
+		require.NoError(t, err)
+		return result.Version
+	}
+	clearTables := func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		require.NoError(t, clearTestDataInTable(testSegmentsTableName, ""))
+	}
+	build := func(t *testing.T, builder *ReplicationBuilder) *replicatedDataStore {
+		store, err := builder.Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store.(*replicatedDataStore)
+	}
+
+	t.Run("writes go to all targets and reads come from the primary", func(t *testing.T) {
+		clearTables(t)
+		store := build(t, ReplicatedDataStore(baseDataStoreBuilder()).Replica("copy", replicaBuilder()))
+
+		require.NoError(t, store.Init(makeData(1)))
+		updated, err := store.Upsert(ldstoreimpl.Features(), "flag1", item(2))
+		require.NoError(t, err)
+		assert.True(t, updated)
+		assert.True(t, store.IsInitialized())
+		assert.Equal(t, 2, getVersion(t, store))
+		assert.Equal(t, 2, getVersion(t, replicaStore(t)))
+
+		replica := replicaStore(t)
+		_, err = replica.Upsert(ldstoreimpl.Features(), "flag1", item(5))
+		require.NoError(t, err)
+		assert.Equal(t, 2, getVersion(t, store))
+	})
+
+	t.Run("fail-all mode returns an error if any target fails", func(t *testing.T) {
+		clearTables(t)
+		replica := &flakyStoreConfigurer{wrapped: replicaBuilder()}
+		store := build(t, ReplicatedDataStore(baseDataStoreBuilder()).Replica("copy", replica))
+		require.NoError(t, store.Init(makeData(1)))
+
+		replica.setFailing(true)
+		_, err := store.Upsert(ldstoreimpl.Features(), "flag1", item(2))
+		assert.True(t, errors.Is(err, errFakeReplicaFailure))
+		assert.Contains(t, err.Error(), `"copy"`)
+
+		status := store.ReplicationStatus()
+		require.Len(t, status, 2)
+		assert.Equal(t, "primary", status[0].Name)
+		assert.True(t, status[0].Primary)
+		assert.Nil(t, status[0].LastError)
+		assert.Equal(t, "copy", status[1].Name)
+		assert.Equal(t, errFakeReplicaFailure, status[1].LastError)
+		assert.Equal(t, 0, status[1].PendingWrites)
+	})
+
+	t.Run("best-effort mode queues failed writes and retries them", func(t *testing.T) {
+		clearTables(t)
+		replica := &flakyStoreConfigurer{wrapped: replicaBuilder()}
+		store := build(t, ReplicatedDataStore(baseDataStoreBuilder()).Replica("copy", replica).
+			Mode(ReplicationBestEffort).RetryInterval(10*time.Millisecond))
+
+		replica.setFailing(true)
+		require.NoError(t, store.Init(makeData(1)))
+		updated, err := store.Upsert(ldstoreimpl.Features(), "flag1", item(2))
+		require.NoError(t, err)
+		assert.True(t, updated)
+
+		status := store.ReplicationStatus()[1]
+		assert.Equal(t, 2, status.PendingWrites)
+		assert.Greater(t, status.Lag, time.Duration(0))
+		assert.Equal(t, errFakeReplicaFailure, status.LastError)
+
+		// a new full data set replaces the queued writes
+		require.NoError(t, store.Init(makeData(3)))
+		assert.Equal(t, 1, store.ReplicationStatus()[1].PendingWrites)
+
+		replica.setFailing(false)
+		require.Eventually(t, func() bool { return store.ReplicationStatus()[1].PendingWrites == 0 },
+			time.Second, 10*time.Millisecond)
+		assert.Equal(t, 3, getVersion(t, replicaStore(t)))
+		assert.Equal(t, time.Duration(0), store.ReplicationStatus()[1].Lag)
+	})
+
+	t.Run("best-effort mode discards the oldest write when the queue is full", func(t *testing.T) {
+		clearTables(t)
+		replica := &flakyStoreConfigurer{wrapped: replicaBuilder()}
+		store := build(t, ReplicatedDataStore(baseDataStoreBuilder()).Replica("copy", replica).
+			Mode(ReplicationBestEffort).RetryInterval(time.Hour).MaxPendingWrites(2))
+
+		replica.setFailing(true)
+		for v := 1; v <= 3; v++ {
+			_, err := store.Upsert(ldstoreimpl.Features(), "flag1", item(v))
+			require.NoError(t, err)
+		}
+		status := store.ReplicationStatus()[1]
+		assert.Equal(t, 2, status.PendingWrites)
+		assert.Equal(t, 1, status.DroppedWrites)
+	})
+
+	t.Run("best-effort mode fails if the primary fails", func(t *testing.T) {
+		clearTables(t)
+		primary := &flakyStoreConfigurer{wrapped: baseDataStoreBuilder()}
+		store := build(t, ReplicatedDataStore(primary).Replica("copy", replicaBuilder()).Mode(ReplicationBestEffort))
+
+		primary.setFailing(true)
+		assert.True(t, errors.Is(store.Init(makeData(1)), errFakeReplicaFailure))
+	})
+
+	t.Run("majority mode succeeds if most targets succeed", func(t *testing.T) {
+		clearTables(t)
+		replica1 := &flakyStoreConfigurer{wrapped: replicaBuilder().Prefix("r1")}
+		replica2 := &flakyStoreConfigurer{wrapped: replicaBuilder().Prefix("r2")}
+		store := build(t, ReplicatedDataStore(baseDataStoreBuilder()).
+			Replica("r1", replica1).Replica("r2", replica2).Mode(ReplicationMajority))
+
+		replica1.setFailing(true)
+		require.NoError(t, store.Init(makeData(1)))
+
+		replica2.setFailing(true)
+		_, err := store.Upsert(ldstoreimpl.Features(), "flag1", item(2))
+		assert.True(t, errors.Is(err, errFakeReplicaFailure))
+	})
+
+	t.Run("majority mode fails if the primary fails", func(t *testing.T) {
+		clearTables(t)
+		primary := &flakyStoreConfigurer{wrapped: baseDataStoreBuilder()}
+		store := build(t, ReplicatedDataStore(primary).
+			Replica("r1", replicaBuilder().Prefix("r1")).Replica("r2", replicaBuilder().Prefix("r2")).
+			Mode(ReplicationMajority))
+
+		primary.setFailing(true)
+		assert.True(t, errors.Is(store.Init(makeData(1)), errFakeReplicaFailure))
+	})
+
+	t.Run("majority mode retries failed writes", func(t *testing.T) {
+		clearTables(t)
+		replica1 := &flakyStoreConfigurer{wrapped: replicaBuilder().Prefix("r1")}
+		store := build(t, ReplicatedDataStore(baseDataStoreBuilder()).
+			Replica("r1", replica1).Replica("r2", replicaBuilder().Prefix("r2")).
+			Mode(ReplicationMajority).RetryInterval(10*time.Millisecond))
+
+		replica1.setFailing(true)
+		require.NoError(t, store.Init(makeData(1)))
+		assert.Equal(t, 1, store.ReplicationStatus()[1].PendingWrites)
+
+		replica1.setFailing(false)
+		require.Eventually(t, func() bool { return store.ReplicationStatus()[1].PendingWrites == 0 },
+			time.Second, 10*time.Millisecond)
+		r1, err := replicaBuilder().Prefix("r1").Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer r1.Close()
+		assert.Equal(t, 1, getVersion(t, r1))
+	})
+
+	t.Run("replica names must be unique", func(t *testing.T) {
+		_, err := ReplicatedDataStore(baseDataStoreBuilder()).Replica("primary", replicaBuilder()).
+			Build(subsystems.BasicClientContext{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,103 @@
+package lddynamodb
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// SharedClient is a DynamoDB client that can be used by any number of data stores and Big Segment
+// stores, so that they share one HTTP connection pool and one set of AWS credentials.
+//
+// This is useful for an application that runs many LaunchDarkly clients, for instance one per
+// environment. Each store still has its own table, prefix, and other options; only the underlying
+// client is shared.
+//
+//	shared := lddynamodb.NewSharedClient().ClientOptions(dynamodb.Options{Region: "us-east-1"})
+//	config1.DataStore = ldcomponents.PersistentDataStore(
+//		lddynamodb.DataStore("table1").Prefix("env1").SharedClient(shared))
+//	config2.DataStore = ldcomponents.PersistentDataStore(
+//		lddynamodb.DataStore("table1").Prefix("env2").SharedClient(shared))
+//
+// The DynamoDB client is created when the first store that uses it is built, and it is reference-
+// counted: when the last of those stores is closed, its idle connections are released. If another
+// store is built after that, a new client is created.
+//
+// The configuration methods of SharedClient must be called before any store uses it.
+type SharedClient struct {
+	builder    builderOptions
+	lock       sync.Mutex
+	client     *dynamodb.Client
+	httpClient interface{ CloseIdleConnections() }
+	refCount   int
+}
+
+// NewSharedClient creates a [SharedClient]. By default, it uses the same AWS configuration as a
+// data store that has no client options: credentials and region are obtained from environment
+// variables and/or local configuration files.
+func NewSharedClient() *SharedClient {
+	return &SharedClient{}
+}
+
+// ClientConfig specifies custom parameters for the dynamodb.NewFromConfig client constructor. This is
+// equivalent to [StoreBuilder.ClientConfig].
+func (c *SharedClient) ClientConfig(options aws.Config, optFns ...func(*dynamodb.Options)) *SharedClient {
+	c.builder.awsConfig = &options
+	c.builder.clientOptions = nil
+	c.builder.clientOptFns = optFns
+	return c
+}
+
+// ClientOptions specifies custom parameters for the dynamodb.New client constructor. This is
+// equivalent to [StoreBuilder.ClientOptions].
+func (c *SharedClient) ClientOptions(options dynamodb.Options, optFns ...func(*dynamodb.Options)) *SharedClient {
+	c.builder.awsConfig = nil
+	c.builder.clientOptions = &options
+	c.builder.clientOptFns = optFns
+	return c
+}
+
+// acquire returns the shared client, creating it if necessary, and adds a reference to it. Each
+// successful call must be matched by a call to release.
+func (c *SharedClient) acquire() (*dynamodb.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client == nil {
+		builder := c.builder
+		// We take ownership of the HTTP client that the AWS SDK creates by default, so that we can
+		// release its connections when the last store is closed. If the application provided its own
+		// HTTP client, we leave it alone.
+		builder.clientOptFns = append(append([]func(*dynamodb.Options){}, builder.clientOptFns...),
+			func(o *dynamodb.Options) {
+				if buildable, ok := o.HTTPClient.(*awshttp.BuildableClient); ok {
+					o.HTTPClient = buildable.Freeze()
+					c.httpClient, _ = o.HTTPClient.(interface{ CloseIdleConnections() })
+				}
+			})
+		client, err := makeClient(builder)
+		if err != nil {
+			return nil, err
+		}
+		c.client = client
+	}
+	c.refCount++
+	return c.client, nil
+}
+
+func (c *SharedClient) release() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.refCount == 0 {
+		return // COVERAGE: should not be possible, since stores only release once
+	}
+	c.refCount--
+	if c.refCount == 0 {
+		if c.httpClient != nil {
+			c.httpClient.CloseIdleConnections()
+		}
+		c.client = nil
+		c.httpClient = nil
+	}
+}
@@ -0,0 +1,84 @@
+package lddynamodb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedClient(t *testing.T) {
+	t.Run("client is reference-counted", func(t *testing.T) {
+		shared := NewSharedClient().ClientOptions(makeTestOptions())
+
+		client1, err := shared.acquire()
+		require.NoError(t, err)
+		client2, err := shared.acquire()
+		require.NoError(t, err)
+		assert.Same(t, client1, client2)
+		assert.NotNil(t, shared.httpClient)
+
+		shared.release()
+		assert.Same(t, client1, shared.client)
+
+		shared.release()
+		assert.Nil(t, shared.client)
+		assert.Nil(t, shared.httpClient)
+
+		client3, err := shared.acquire()
+		require.NoError(t, err)
+		assert.NotSame(t, client1, client3)
+		shared.release()
+	})
+
+	t.Run("error for invalid configuration", func(t *testing.T) {
+		os.Setenv("AWS_CA_BUNDLE", "not a real CA file")
+		defer os.Setenv("AWS_CA_BUNDLE", "")
+
+		shared := NewSharedClient()
+		ds, err := DataStore("t").SharedClient(shared).Build(subsystems.BasicClientContext{})
+		assert.Error(t, err)
+		assert.Nil(t, ds)
+		assert.Equal(t, 0, shared.refCount)
+	})
+
+	t.Run("stores with different prefixes share a client", func(t *testing.T) {
+		require.NoError(t, createTableIfNecessary())
+		require.NoError(t, clearTestData("shared1"))
+		require.NoError(t, clearTestData("shared2"))
+
+		shared := NewSharedClient().ClientOptions(makeTestOptions())
+		store1, err := DataStore(testTableName).Prefix("shared1").SharedClient(shared).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		store2, err := DataStore(testTableName).Prefix("shared2").SharedClient(shared).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		bigSegmentStore, err := BigSegmentStore(testTableName).Prefix("shared2").SharedClient(shared).
+			Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		assert.Equal(t, 3, shared.refCount)
+		assert.Same(t, store1.(*dynamoDBDataStore).client, store2.(*dynamoDBDataStore).client)
+
+		require.NoError(t, store1.Init([]ldstoretypes.SerializedCollection{
+			{Kind: ldstoreimpl.Features(), Items: nil},
+		}))
+		assert.True(t, store1.IsInitialized())
+		assert.False(t, store2.IsInitialized())
+
+		require.NoError(t, store1.Close())
+		require.NoError(t, store1.Close()) // closing twice does not release twice
+		assert.Equal(t, 2, shared.refCount)
+		assert.True(t, store2.IsStoreAvailable())
+
+		require.NoError(t, bigSegmentStore.Close())
+		require.NoError(t, store2.Close())
+		assert.Equal(t, 0, shared.refCount)
+		assert.Nil(t, shared.client)
+	})
+}
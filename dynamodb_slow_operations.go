@@ -0,0 +1,98 @@
+package lddynamodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// slowOperationLogger logs a warning for each GetItem, Query, PutItem, or BatchWriteItem request that
+// takes longer than the threshold, including any retries done by the AWS SDK. A nil
+// *slowOperationLogger means that the threshold is not set.
+type slowOperationLogger struct {
+	threshold time.Duration
+	table     string
+	loggers   ldlog.Loggers
+}
+
+func newSlowOperationLogger(threshold time.Duration, table string, loggers ldlog.Loggers) *slowOperationLogger {
+	if threshold <= 0 {
+		return nil
+	}
+	return &slowOperationLogger{threshold: threshold, table: table, loggers: loggers}
+}
+
+// addMiddleware is passed to each DynamoDB client call when the threshold is set.
+func (l *slowOperationLogger) addMiddleware(options *dynamodb.Options) {
+	options.APIOptions = append(options.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("LaunchDarklySlowOperations", l.handleInitialize),
+			middleware.After)
+	})
+}
+
+func (l *slowOperationLogger) handleInitialize(
+	ctx context.Context,
+	in middleware.InitializeInput,
+	next middleware.InitializeHandler,
+) (middleware.InitializeOutput, middleware.Metadata, error) {
+	startTime := time.Now()
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	duration := time.Since(startTime)
+	if duration < l.threshold {
+		return out, metadata, err
+	}
+	details := describeSlowRequest(in.Parameters)
+	if details == nil {
+		return out, metadata, err // not one of the operations we report
+	}
+	table := tableOfRequest(in.Parameters)
+	if table == "" {
+		table = l.table // COVERAGE: we only write to one table in each batch
+	}
+	attempts := 1
+	if results, ok := retry.GetAttemptResults(metadata); ok && len(results.Results) > 0 {
+		attempts = len(results.Results)
+	}
+	l.loggers.Warnf("Slow DynamoDB operation (operation=%s table=%s %s attempts=%d duration=%s)",
+		awsmiddleware.GetOperationName(ctx), table, strings.Join(details, " "), attempts, duration)
+	return out, metadata, err
+}
+
+// describeSlowRequest returns key=value strings describing which items a request accessed, or nil if
+// the request is not for an operation whose slowness we report.
+func describeSlowRequest(params interface{}) []string {
+	switch input := params.(type) {
+	case *dynamodb.GetItemInput:
+		return []string{
+			"namespace=" + attrValueToString(input.Key[tablePartitionKey]),
+			"key=" + attrValueToString(input.Key[tableSortKey]),
+		}
+	case *dynamodb.QueryInput:
+		namespace := ""
+		if cond, ok := input.KeyConditions[tablePartitionKey]; ok && len(cond.AttributeValueList) > 0 {
+			namespace = attrValueToString(cond.AttributeValueList[0])
+		}
+		return []string{"namespace=" + namespace}
+	case *dynamodb.PutItemInput:
+		return []string{
+			"namespace=" + attrValueToString(input.Item[tablePartitionKey]),
+			"key=" + attrValueToString(input.Item[tableSortKey]),
+		}
+	case *dynamodb.BatchWriteItemInput:
+		size := 0
+		for _, requests := range input.RequestItems {
+			size += len(requests)
+		}
+		return []string{fmt.Sprintf("batchSize=%d", size)}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package lddynamodb
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+	"github.com/launchdarkly/go-sdk-common/v3/ldlogtest"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlowOperationLogging(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	makeStore := func(t *testing.T, threshold time.Duration) (subsystems.PersistentDataStore, *ldlogtest.MockLog) {
+		mockLog := ldlogtest.NewMockLog()
+		ctx := subsystems.BasicClientContext{}
+		ctx.Logging.Loggers = mockLog.Loggers
+		store, err := baseDataStoreBuilder().SlowOperationThreshold(threshold).Build(ctx)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store, mockLog
+	}
+	data := []ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+			{Key: "flag1", Item: ldstoretypes.SerializedItemDescriptor{Version: 1, SerializedItem: []byte(`{}`)}},
+		}},
+	}
+
+	t.Run("requests slower than the threshold are logged", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store, mockLog := makeStore(t, time.Nanosecond)
+
+		require.NoError(t, store.Init(data))
+		_, err := store.Get(ldstoreimpl.Features(), "flag1")
+		require.NoError(t, err)
+		_, err = store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		_, err = store.Upsert(ldstoreimpl.Features(), "flag2",
+			ldstoretypes.SerializedItemDescriptor{Version: 1, SerializedItem: []byte(`{}`)})
+		require.NoError(t, err)
+
+		for _, pattern := range []string{
+			`operation=BatchWriteItem table=` + testTableName + ` batchSize=1 attempts=1 duration=`,
+			`operation=GetItem table=` + testTableName + ` namespace=features key=flag1 attempts=1 duration=`,
+			`operation=Query table=` + testTableName + ` namespace=features attempts=1 duration=`,
+			`operation=PutItem table=` + testTableName + ` namespace=features key=flag2 attempts=1 duration=`,
+		} {
+			mockLog.AssertMessageMatch(t, true, ldlog.Warn, `Slow DynamoDB operation \(`+regexp.QuoteMeta(pattern))
+		}
+		mockLog.AssertMessageMatch(t, false, ldlog.Warn, "operation=UpdateItem")
+	})
+
+	t.Run("requests faster than the threshold are not logged", func(t *testing.T) {
+		store, mockLog := makeStore(t, time.Hour)
+		_, err := store.Get(ldstoreimpl.Features(), "flag1")
+		require.NoError(t, err)
+		assert.Len(t, mockLog.GetOutput(ldlog.Warn), 0)
+	})
+
+	t.Run("Big Segment store", func(t *testing.T) {
+		mockLog := ldlogtest.NewMockLog()
+		ctx := subsystems.BasicClientContext{}
+		ctx.Logging.Loggers = mockLog.Loggers
+		store, err := BigSegmentStore(testTableName).ClientOptions(makeTestOptions()).
+			SlowOperationThreshold(time.Nanosecond).Build(ctx)
+		require.NoError(t, err)
+		defer store.Close()
+
+		_, err = store.GetMembership("abc")
+		require.NoError(t, err)
+		mockLog.AssertMessageMatch(t, true, ldlog.Warn, "operation=GetItem .* namespace=big_segments_user key=abc")
+	})
+}
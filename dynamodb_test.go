@@ -26,8 +26,9 @@ import (
 )
 
 const (
-	testTableName = "LD_DYNAMODB_TEST_TABLE"
-	localEndpoint = "http://localhost:8000"
+	testTableName         = "LD_DYNAMODB_TEST_TABLE"
+	testSegmentsTableName = "LD_DYNAMODB_TEST_SEGMENTS_TABLE"
+	localEndpoint         = "http://localhost:8000"
 )
 
 func TestDynamoDBDataStore(t *testing.T) {
@@ -179,6 +180,238 @@ func TestDataStoreSkipsAndLogsTooLargeItem(t *testing.T) {
 	})
 }
 
+func TestDataStoreWithSeparateKindTables(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+	require.NoError(t, createNamedTableIfNecessary(testSegmentsTableName))
+	require.NoError(t, clearTestData(""))
+	require.NoError(t, clearTestDataInTable(testSegmentsTableName, ""))
+
+	flag1 := ldstoretypes.KeyedSerializedItemDescriptor{Key: "flag1", Item: ldstoretypes.SerializedItemDescriptor{
+		Version: 1, SerializedItem: []byte(`{"key": "flag1", "version": 1}`),
+	}}
+	segment1 := ldstoretypes.KeyedSerializedItemDescriptor{Key: "segment1", Item: ldstoretypes.SerializedItemDescriptor{
+		Version: 1, SerializedItem: []byte(`{"key": "segment1", "version": 1}`),
+	}}
+	segment2 := ldstoretypes.KeyedSerializedItemDescriptor{Key: "segment2", Item: ldstoretypes.SerializedItemDescriptor{
+		Version: 1, SerializedItem: []byte(`{"key": "segment2", "version": 1}`),
+	}}
+
+	store, err := baseDataStoreBuilder().
+		KindTables(map[string]string{ldstoreimpl.Segments().GetName(): testSegmentsTableName}).
+		Build(subsystems.BasicClientContext{})
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Init([]ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{flag1}},
+		{Kind: ldstoreimpl.Segments(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{segment1, segment2}},
+	}))
+	assert.True(t, store.IsInitialized())
+
+	itemExists := func(table, namespace, key string) bool {
+		result, err := createTestClient().GetItem(context.Background(), &dynamodb.GetItemInput{
+			TableName: aws.String(table),
+			Key: map[string]types.AttributeValue{
+				tablePartitionKey: attrValueOfString(namespace),
+				tableSortKey:      attrValueOfString(key),
+			},
+		})
+		require.NoError(t, err)
+		return len(result.Item) != 0
+	}
+	assert.True(t, itemExists(testTableName, "features", "flag1"))
+	assert.True(t, itemExists(testTableName, "$inited", "$inited"))
+	assert.True(t, itemExists(testSegmentsTableName, "segments", "segment1"))
+	assert.False(t, itemExists(testTableName, "segments", "segment1"))
+	assert.False(t, itemExists(testSegmentsTableName, "$inited", "$inited"))
+
+	segments, err := store.GetAll(ldstoreimpl.Segments())
+	require.NoError(t, err)
+	assert.Equal(t, []ldstoretypes.KeyedSerializedItemDescriptor{segment1, segment2}, segments)
+
+	// a second Init should delete the segment that is no longer present, from the right table
+	require.NoError(t, store.Init([]ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{flag1}},
+		{Kind: ldstoreimpl.Segments(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{segment1}},
+	}))
+	assert.False(t, itemExists(testSegmentsTableName, "segments", "segment2"))
+
+	updated, err := store.Upsert(ldstoreimpl.Segments(), "segment2", segment2.Item)
+	require.NoError(t, err)
+	assert.True(t, updated)
+	assert.True(t, itemExists(testSegmentsTableName, "segments", "segment2"))
+}
+
+func TestDataStoreConcurrentInit(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+	require.NoError(t, clearTestData(""))
+
+	makeData := func(numFlags, numSegments, version int) []ldstoretypes.SerializedCollection {
+		makeItems := func(prefix string, count int) []ldstoretypes.KeyedSerializedItemDescriptor {
+			var ret []ldstoretypes.KeyedSerializedItemDescriptor
+			for i := 0; i < count; i++ {
+				key := fmt.Sprintf("%s%03d", prefix, i)
+				ret = append(ret, ldstoretypes.KeyedSerializedItemDescriptor{
+					Key: key,
+					Item: ldstoretypes.SerializedItemDescriptor{
+						Version:        version,
+						SerializedItem: []byte(fmt.Sprintf(`{"key": "%s", "version": %d}`, key, version)),
+					},
+				})
+			}
+			return ret
+		}
+		return []ldstoretypes.SerializedCollection{
+			{Kind: ldstoreimpl.Features(), Items: makeItems("flag", numFlags)},
+			{Kind: ldstoreimpl.Segments(), Items: makeItems("segment", numSegments)},
+		}
+	}
+
+	store, err := baseDataStoreBuilder().InitConcurrency(4).Build(subsystems.BasicClientContext{})
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Init(makeData(200, 60, 1)))
+	assert.True(t, store.IsInitialized())
+
+	newData := makeData(120, 80, 2)
+	require.NoError(t, store.Init(newData))
+
+	flags, err := store.GetAll(ldstoreimpl.Features())
+	require.NoError(t, err)
+	assert.Equal(t, newData[0].Items, flags)
+	segments, err := store.GetAll(ldstoreimpl.Segments())
+	require.NoError(t, err)
+	assert.Equal(t, newData[1].Items, segments)
+}
+
+func TestDataStoreInitDoesNotDeleteItemChangedByAnotherWriter(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+	require.NoError(t, clearTestData(""))
+
+	makeItem := func(key string, version int) ldstoretypes.KeyedSerializedItemDescriptor {
+		return ldstoretypes.KeyedSerializedItemDescriptor{Key: key, Item: ldstoretypes.SerializedItemDescriptor{
+			Version: version, SerializedItem: []byte(fmt.Sprintf(`{"key": "%s", "version": %d}`, key, version)),
+		}}
+	}
+	flag1, flag2v1, flag2v2, flag3 := makeItem("flag1", 1), makeItem("flag2", 1), makeItem("flag2", 2), makeItem("flag3", 1)
+
+	otherWriter, err := baseDataStoreBuilder().Build(subsystems.BasicClientContext{})
+	require.NoError(t, err)
+	defer otherWriter.Close()
+	require.NoError(t, otherWriter.Init([]ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{flag1, flag2v1, flag3}},
+	}))
+
+	// The progress handler lets us make a change after Init has read the existing keys, but before
+	// it deletes the ones that are not in its data set.
+	mockLog := ldlogtest.NewMockLog()
+	ctx := subsystems.BasicClientContext{}
+	ctx.Logging.Loggers = mockLog.Loggers
+	store, err := baseDataStoreBuilder().InitProgressHandler(func(p InitProgress) {
+		if p.Phase == InitPhaseWriting && p.Done == 0 {
+			updated, err := otherWriter.Upsert(ldstoreimpl.Features(), flag2v2.Key, flag2v2.Item)
+			require.NoError(t, err)
+			require.True(t, updated)
+		}
+	}).Build(ctx)
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Init([]ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{flag1}},
+	}))
+
+	flags, err := store.GetAll(ldstoreimpl.Features())
+	require.NoError(t, err)
+	assert.Equal(t, []ldstoretypes.KeyedSerializedItemDescriptor{flag1, flag2v2}, flags)
+	assert.True(t, mockLog.HasMessageMatch(ldlog.Info, `Not deleting "flag2" in "features"`))
+}
+
+func TestDataStoreSkipUnchangedInit(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	makeData := func(version int, keys ...string) []ldstoretypes.SerializedCollection {
+		var items []ldstoretypes.KeyedSerializedItemDescriptor
+		for _, key := range keys {
+			items = append(items, ldstoretypes.KeyedSerializedItemDescriptor{Key: key,
+				Item: ldstoretypes.SerializedItemDescriptor{Version: version, SerializedItem: []byte(`{}`)}})
+		}
+		return []ldstoretypes.SerializedCollection{{Kind: ldstoreimpl.Features(), Items: items}}
+	}
+
+	makeStore := func(t *testing.T, builder *StoreBuilder[subsystems.PersistentDataStore]) (
+		*dynamoDBDataStore, *int) {
+		initWrites := 0
+		store, err := builder.InitProgressHandler(func(p InitProgress) {
+			if p.Phase == InitPhaseWriting && p.Done == 0 {
+				initWrites++
+			}
+		}).Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store.(*dynamoDBDataStore), &initWrites
+	}
+
+	t.Run("same data is not written again", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store, initWrites := makeStore(t, baseDataStoreBuilder().SkipUnchangedInit())
+		require.NoError(t, store.Init(makeData(1, "flag1", "flag2")))
+		require.NoError(t, store.Init(makeData(1, "flag2", "flag1")))
+		assert.Equal(t, 1, *initWrites)
+		assert.True(t, store.IsInitialized())
+	})
+
+	t.Run("changed data is written", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store, initWrites := makeStore(t, baseDataStoreBuilder().SkipUnchangedInit())
+		require.NoError(t, store.Init(makeData(1, "flag1", "flag2")))
+		require.NoError(t, store.Init(makeData(2, "flag1", "flag2")))
+		require.NoError(t, store.Init(makeData(2, "flag1")))
+		assert.Equal(t, 3, *initWrites)
+
+		flags, err := store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.Equal(t, makeData(2, "flag1")[0].Items, flags)
+	})
+
+	t.Run("data is written if there is no recorded hash", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		otherStore, _ := makeStore(t, baseDataStoreBuilder())
+		require.NoError(t, otherStore.Init(makeData(1, "flag1")))
+
+		store, initWrites := makeStore(t, baseDataStoreBuilder().SkipUnchangedInit())
+		require.NoError(t, store.Init(makeData(1, "flag1")))
+		assert.Equal(t, 1, *initWrites)
+	})
+
+	t.Run("data is written if the previous Init did not complete", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store, initWrites := makeStore(t, baseDataStoreBuilder().SkipUnchangedInit())
+		require.NoError(t, store.Init(makeData(1, "flag1")))
+		require.NoError(t, store.startInitRun(store.context, "run1"))
+		require.NoError(t, store.Init(makeData(1, "flag1")))
+		assert.Equal(t, 2, *initWrites)
+	})
+
+	t.Run("data is written if the table was updated since the previous Init", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store, initWrites := makeStore(t, baseDataStoreBuilder().SkipUnchangedInit())
+		require.NoError(t, store.Init(makeData(1, "flag1", "flag2")))
+		_, err := store.Upsert(ldstoreimpl.Features(), "flag1", makeData(2, "flag1")[0].Items[0].Item)
+		require.NoError(t, err)
+		require.NoError(t, store.Init(makeData(1, "flag1", "flag2")))
+		assert.Equal(t, 2, *initWrites)
+
+		_, err = store.UpsertMany([]UpsertItem{
+			{Kind: ldstoreimpl.Features(), Key: "flag2", Item: makeData(2, "flag2")[0].Items[0].Item},
+		})
+		require.NoError(t, err)
+		require.NoError(t, store.Init(makeData(1, "flag1", "flag2")))
+		assert.Equal(t, 3, *initWrites)
+	})
+}
+
 func baseDataStoreBuilder() *StoreBuilder[subsystems.PersistentDataStore] {
 	return DataStore(testTableName).ClientOptions(makeTestOptions())
 }
@@ -198,6 +431,10 @@ func verifyFailedStoreError(t assert.TestingT, err error) {
 }
 
 func clearTestData(prefix string) error {
+	return clearTestDataInTable(testTableName, prefix)
+}
+
+func clearTestDataInTable(tableName, prefix string) error {
 	if prefix != "" {
 		prefix += ":"
 	}
@@ -206,7 +443,7 @@ func clearTestData(prefix string) error {
 	var items []map[string]types.AttributeValue
 
 	scanInput := dynamodb.ScanInput{
-		TableName:            aws.String(testTableName),
+		TableName:            aws.String(tableName),
 		ConsistentRead:       aws.Bool(true),
 		ProjectionExpression: aws.String("#namespace, #key"),
 		ExpressionAttributeNames: map[string]string{
@@ -234,7 +471,7 @@ func clearTestData(prefix string) error {
 			})
 		}
 	}
-	return batchWriteRequests(context.Background(), client, testTableName, requests)
+	return batchWriteRequests(context.Background(), client, tableName, requests, nil)
 }
 
 func setConcurrentModificationHook(store subsystems.PersistentDataStore, hook func()) {
@@ -247,16 +484,24 @@ func createTestClient() *dynamodb.Client {
 
 func makeTestOptions() dynamodb.Options {
 	return dynamodb.Options{
-		Credentials:      credentials.NewStaticCredentialsProvider("dummy", "not", "used"),
-		EndpointResolver: dynamodb.EndpointResolverFromURL(localEndpoint),
-		Region:           "us-east-1", // this is ignored for a local instance, but is still required
+		Credentials: credentials.NewStaticCredentialsProvider("dummy", "not", "used"),
+		// Setting the signing region up front avoids a data race in the AWS SDK's resolver, which
+		// otherwise sets it lazily on every request and would be flagged when requests run in parallel.
+		EndpointResolver: dynamodb.EndpointResolverFromURL(localEndpoint, func(e *aws.Endpoint) {
+			e.SigningRegion = "us-east-1"
+		}),
+		Region: "us-east-1", // this is ignored for a local instance, but is still required
 	}
 }
 
 func createTableIfNecessary() error {
+	return createNamedTableIfNecessary(testTableName)
+}
+
+func createNamedTableIfNecessary(tableName string) error {
 	client := createTestClient()
 	_, err := client.DescribeTable(context.Background(),
-		&dynamodb.DescribeTableInput{TableName: aws.String(testTableName)})
+		&dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
 	if err == nil {
 		return nil
 	}
@@ -289,7 +534,7 @@ func createTableIfNecessary() error {
 			ReadCapacityUnits:  aws.Int64(1),
 			WriteCapacityUnits: aws.Int64(1),
 		},
-		TableName: aws.String(testTableName),
+		TableName: aws.String(tableName),
 	}
 	_, err = client.CreateTable(context.Background(), &createParams)
 	if err != nil {
@@ -305,7 +550,7 @@ func createTableIfNecessary() error {
 			return fmt.Errorf("timed out waiting for new table to be ready")
 		case <-retry.C:
 			tableInfo, err := client.DescribeTable(context.Background(),
-				&dynamodb.DescribeTableInput{TableName: aws.String(testTableName)})
+				&dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
 			if err == nil && tableInfo.Table.TableStatus == types.TableStatusActive {
 				return nil
 			}
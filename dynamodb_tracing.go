@@ -0,0 +1,260 @@
+package lddynamodb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// SpanAttributes describes the store operation that a span started by [Tracer] is for.
+type SpanAttributes struct {
+	// Table is the name of the DynamoDB table.
+	Table string
+	// Prefix is the store's key prefix, which is "" if there is none.
+	Prefix string
+	// Kind is the name of the data kind, such as "features" or "segments", or "" if the operation is
+	// not for one kind.
+	Kind string
+}
+
+// SpanResult describes how a store operation ended. It is passed to [Span.End].
+type SpanResult struct {
+	// KeyCount is the number of keys that the operation read or wrote, or -1 if the operation is not
+	// for specific keys.
+	KeyCount int
+	// ConsumedCapacity is the total number of DynamoDB capacity units consumed by the operation.
+	ConsumedCapacity float64
+	// ConditionalCheckFailures is the number of writes that DynamoDB rejected because of their
+	// conditions.
+	ConditionalCheckFailures int
+	// Outcome is one of SpanOutcomeSuccess, SpanOutcomeNotUpdated,
+	// SpanOutcomeConditionalCheckFailed, or SpanOutcomeError.
+	Outcome string
+	// Err is the error that the operation returned, if any.
+	Err error
+}
+
+// Values of SpanResult.Outcome
+const (
+	// SpanOutcomeSuccess means that the operation succeeded.
+	SpanOutcomeSuccess = "success"
+	// SpanOutcomeNotUpdated means that an update succeeded but did not change the data.
+	SpanOutcomeNotUpdated = "not_updated"
+	// SpanOutcomeConditionalCheckFailed means that an update did not change the data because
+	// DynamoDB rejected it, as happens when the store already has the same or a newer version.
+	SpanOutcomeConditionalCheckFailed = "conditional_check_failed"
+	// SpanOutcomeError means that the operation returned an error.
+	SpanOutcomeError = "error"
+)
+
+// Tracer starts a span for each operation of a data store or Big Segment store, so that an
+// application can see the store's work in its traces. See [StoreBuilder.Tracer].
+//
+// The ldotel subpackage provides an implementation that uses OpenTelemetry. The methods may be
+// called concurrently from many goroutines.
+type Tracer interface {
+	// StartSpan is called at the start of an operation. The name is the type of store followed by the
+	// operation, such as "DynamoDBDataStore.Get" or "DynamoDBBigSegmentStore.GetMembership". The
+	// returned context is used for the operation's DynamoDB requests.
+	StartSpan(ctx context.Context, name string, attributes SpanAttributes) (context.Context, Span)
+}
+
+// Span is a span started by [Tracer.StartSpan].
+type Span interface {
+	// End is called once, when the operation is done.
+	End(result SpanResult)
+}
+
+// If the application provides a Tracer, each store operation runs in a span. The span is carried in
+// the context that is passed to the DynamoDB client, and a middleware that is added to each client
+// call asks DynamoDB for the capacity it consumed, so that it can be added up for the span, and
+// counts conditional-check failures.
+
+type storeTracer struct {
+	tracer     Tracer
+	spanPrefix string
+	table      string
+	prefix     string
+}
+
+type storeSpan struct {
+	span                     Span
+	lock                     sync.Mutex
+	keyCount                 int
+	consumedCapacity         float64
+	conditionalCheckFailures int
+}
+
+type storeSpanContextKey struct{}
+
+// newStoreTracer returns nil if tracer is nil, meaning that tracing is disabled; start can be
+// called on a nil *storeTracer, and all of the storeSpan methods on a nil *storeSpan.
+func newStoreTracer(tracer Tracer, spanPrefix, table, prefix string) *storeTracer {
+	if tracer == nil {
+		return nil
+	}
+	return &storeTracer{tracer: tracer, spanPrefix: spanPrefix, table: table, prefix: prefix}
+}
+
+// start begins a span for a store operation, and returns a context to use for the operation's
+// DynamoDB requests. The kind is "" if the operation is not for one data kind.
+func (t *storeTracer) start(
+	ctx context.Context,
+	operation string,
+	kind string,
+) (context.Context, *storeSpan) {
+	if t == nil {
+		return ctx, nil
+	}
+	ctx, span := t.tracer.StartSpan(ctx, t.spanPrefix+operation,
+		SpanAttributes{Table: t.table, Prefix: t.prefix, Kind: kind})
+	s := &storeSpan{span: span, keyCount: -1}
+	return context.WithValue(ctx, storeSpanContextKey{}, s), s
+}
+
+func storeSpanFromContext(ctx context.Context) *storeSpan {
+	s, _ := ctx.Value(storeSpanContextKey{}).(*storeSpan)
+	return s
+}
+
+func (s *storeSpan) setKeyCount(count int) {
+	if s != nil {
+		s.lock.Lock()
+		s.keyCount = count
+		s.lock.Unlock()
+	}
+}
+
+// end finishes the span. If err is nil, the outcome is SpanOutcomeSuccess unless another outcome is
+// specified.
+func (s *storeSpan) end(err error, outcome ...string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	result := SpanResult{
+		KeyCount:                 s.keyCount,
+		ConsumedCapacity:         s.consumedCapacity,
+		ConditionalCheckFailures: s.conditionalCheckFailures,
+		Outcome:                  SpanOutcomeSuccess,
+		Err:                      err,
+	}
+	s.lock.Unlock()
+	switch {
+	case err != nil:
+		result.Outcome = SpanOutcomeError
+	case len(outcome) > 0:
+		result.Outcome = outcome[0]
+	}
+	s.span.End(result)
+}
+
+// endUpdate is like end, for an operation that reports whether it updated the data. If it did not,
+// the outcome says whether that was because of a conditional check.
+func (s *storeSpan) endUpdate(err error, updated bool) {
+	if s == nil || updated {
+		s.end(err)
+		return
+	}
+	s.lock.Lock()
+	outcome := SpanOutcomeNotUpdated
+	if s.conditionalCheckFailures > 0 {
+		outcome = SpanOutcomeConditionalCheckFailed
+	}
+	s.lock.Unlock()
+	s.end(err, outcome)
+}
+
+func (s *storeSpan) recordCall(result interface{}, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.consumedCapacity += consumedCapacityOf(result)
+	s.conditionalCheckFailures += conditionalCheckFailures(err)
+}
+
+// addTracingMiddleware is passed to each DynamoDB client call when tracing is enabled.
+func addTracingMiddleware(options *dynamodb.Options) {
+	options.APIOptions = append(options.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(tracingMiddleware, middleware.After)
+	})
+}
+
+var tracingMiddleware = middleware.InitializeMiddlewareFunc("LaunchDarklyTracing", func(
+	ctx context.Context,
+	in middleware.InitializeInput,
+	next middleware.InitializeHandler,
+) (middleware.InitializeOutput, middleware.Metadata, error) {
+	span := storeSpanFromContext(ctx)
+	if span == nil {
+		return next.HandleInitialize(ctx, in)
+	}
+	requestConsumedCapacity(in.Parameters)
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	span.recordCall(out.Result, err)
+	return out, metadata, err
+})
+
+// requestConsumedCapacity asks DynamoDB to report the capacity consumed by a request, unless the
+// request already specifies what to report.
+func requestConsumedCapacity(params interface{}) {
+	set := func(value *types.ReturnConsumedCapacity) {
+		if *value == "" {
+			*value = types.ReturnConsumedCapacityTotal
+		}
+	}
+	switch input := params.(type) {
+	case *dynamodb.GetItemInput:
+		set(&input.ReturnConsumedCapacity)
+	case *dynamodb.QueryInput:
+		set(&input.ReturnConsumedCapacity)
+	case *dynamodb.PutItemInput:
+		set(&input.ReturnConsumedCapacity)
+	case *dynamodb.UpdateItemInput:
+		set(&input.ReturnConsumedCapacity)
+	case *dynamodb.DeleteItemInput:
+		set(&input.ReturnConsumedCapacity)
+	case *dynamodb.BatchWriteItemInput:
+		set(&input.ReturnConsumedCapacity)
+	case *dynamodb.TransactWriteItemsInput:
+		set(&input.ReturnConsumedCapacity)
+	}
+}
+
+// consumedCapacityOf returns the total capacity units reported in the output of a request.
+func consumedCapacityOf(result interface{}) float64 {
+	total := func(ccs ...types.ConsumedCapacity) float64 {
+		units := 0.0
+		for _, cc := range ccs {
+			units += aws.ToFloat64(cc.CapacityUnits)
+		}
+		return units
+	}
+	one := func(cc *types.ConsumedCapacity) float64 {
+		if cc == nil {
+			return 0
+		}
+		return total(*cc)
+	}
+	switch output := result.(type) {
+	case *dynamodb.GetItemOutput:
+		return one(output.ConsumedCapacity)
+	case *dynamodb.QueryOutput:
+		return one(output.ConsumedCapacity)
+	case *dynamodb.PutItemOutput:
+		return one(output.ConsumedCapacity)
+	case *dynamodb.UpdateItemOutput:
+		return one(output.ConsumedCapacity)
+	case *dynamodb.DeleteItemOutput:
+		return one(output.ConsumedCapacity)
+	case *dynamodb.BatchWriteItemOutput:
+		return total(output.ConsumedCapacity...)
+	case *dynamodb.TransactWriteItemsOutput:
+		return total(output.ConsumedCapacity...)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,155 @@
+package lddynamodb
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedSpan struct {
+	name       string
+	attributes SpanAttributes
+	result     SpanResult
+	tracer     *recordedTracer
+}
+
+type recordedTracer struct {
+	lock  sync.Mutex
+	ended []*recordedSpan
+}
+
+func (t *recordedTracer) StartSpan(ctx context.Context, name string, attributes SpanAttributes) (context.Context,
+	Span) {
+	return ctx, &recordedSpan{name: name, attributes: attributes, tracer: t}
+}
+
+func (s *recordedSpan) End(result SpanResult) {
+	s.result = result
+	s.tracer.lock.Lock()
+	s.tracer.ended = append(s.tracer.ended, s)
+	s.tracer.lock.Unlock()
+}
+
+// lastSpan returns the most recently ended span.
+func (t *recordedTracer) lastSpan(tt *testing.T, name string) *recordedSpan {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	require.NotEmpty(tt, t.ended)
+	span := t.ended[len(t.ended)-1]
+	require.Equal(tt, name, span.name)
+	return span
+}
+
+func TestStoreTracing(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	flag := func(version int) ldstoretypes.SerializedItemDescriptor {
+		return ldstoretypes.SerializedItemDescriptor{Version: version, SerializedItem: []byte(`{}`)}
+	}
+	data := []ldstoretypes.SerializedCollection{
+		{Kind: ldstoreimpl.Features(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+			{Key: "flag1", Item: flag(1)}, {Key: "flag2", Item: flag(1)},
+		}},
+		{Kind: ldstoreimpl.Segments(), Items: []ldstoretypes.KeyedSerializedItemDescriptor{
+			{Key: "segment1", Item: flag(1)},
+		}},
+	}
+
+	t.Run("data store", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		tracer := &recordedTracer{}
+		store, err := baseDataStoreBuilder().Tracer(tracer).Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+
+		require.NoError(t, store.Init(data))
+		span := tracer.lastSpan(t, "DynamoDBDataStore.Init")
+		assert.Equal(t, SpanAttributes{Table: testTableName}, span.attributes)
+		assert.Equal(t, 3, span.result.KeyCount)
+		assert.Greater(t, span.result.ConsumedCapacity, 0.0)
+		assert.Equal(t, SpanOutcomeSuccess, span.result.Outcome)
+		assert.NoError(t, span.result.Err)
+
+		assert.True(t, store.IsInitialized())
+		span = tracer.lastSpan(t, "DynamoDBDataStore.IsInitialized")
+		assert.Equal(t, -1, span.result.KeyCount)
+		assert.Greater(t, span.result.ConsumedCapacity, 0.0)
+
+		items, err := store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		span = tracer.lastSpan(t, "DynamoDBDataStore.GetAll")
+		assert.Equal(t, "features", span.attributes.Kind)
+		assert.Equal(t, 2, span.result.KeyCount)
+		assert.Greater(t, span.result.ConsumedCapacity, 0.0)
+
+		_, err = store.Get(ldstoreimpl.Segments(), "segment1")
+		require.NoError(t, err)
+		span = tracer.lastSpan(t, "DynamoDBDataStore.Get")
+		assert.Equal(t, "segments", span.attributes.Kind)
+		assert.Equal(t, 1, span.result.KeyCount)
+		assert.Equal(t, SpanOutcomeSuccess, span.result.Outcome)
+
+		updated, err := store.Upsert(ldstoreimpl.Features(), "flag1", flag(2))
+		require.NoError(t, err)
+		require.True(t, updated)
+		span = tracer.lastSpan(t, "DynamoDBDataStore.Upsert")
+		assert.Equal(t, SpanOutcomeSuccess, span.result.Outcome)
+		assert.Equal(t, 0, span.result.ConditionalCheckFailures)
+
+		updated, err = store.Upsert(ldstoreimpl.Features(), "flag1", flag(1))
+		require.NoError(t, err)
+		require.False(t, updated)
+		span = tracer.lastSpan(t, "DynamoDBDataStore.Upsert")
+		assert.Equal(t, SpanOutcomeConditionalCheckFailed, span.result.Outcome)
+		assert.Equal(t, 1, span.result.ConditionalCheckFailures)
+	})
+
+	t.Run("data store error", func(t *testing.T) {
+		tracer := &recordedTracer{}
+		store, err := DataStore(testTableName).Tracer(tracer).Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+
+		_, err = store.Get(ldstoreimpl.Features(), "flag1")
+		require.Error(t, err)
+		span := tracer.lastSpan(t, "DynamoDBDataStore.Get")
+		assert.Equal(t, SpanOutcomeError, span.result.Outcome)
+		assert.Equal(t, err, span.result.Err)
+	})
+
+	t.Run("Big Segment store", func(t *testing.T) {
+		tracer := &recordedTracer{}
+		store, err := BigSegmentStore(testTableName).ClientOptions(makeTestOptions()).Prefix("traced").
+			Tracer(tracer).Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+
+		_, err = store.GetMetadata()
+		require.NoError(t, err)
+		span := tracer.lastSpan(t, "DynamoDBBigSegmentStore.GetMetadata")
+		assert.Equal(t, SpanAttributes{Table: testTableName, Prefix: "traced"}, span.attributes)
+		assert.Equal(t, SpanOutcomeSuccess, span.result.Outcome)
+		assert.Greater(t, span.result.ConsumedCapacity, 0.0)
+
+		_, err = store.GetMembership("abc")
+		require.NoError(t, err)
+		span = tracer.lastSpan(t, "DynamoDBBigSegmentStore.GetMembership")
+		assert.Equal(t, 1, span.result.KeyCount)
+	})
+
+	t.Run("tracing is disabled by default", func(t *testing.T) {
+		store, err := baseDataStoreBuilder().Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		defer store.Close()
+		assert.Nil(t, store.(*dynamoDBDataStore).tracer)
+		assert.Len(t, store.(*dynamoDBDataStore).apiOptions, 0)
+	})
+}
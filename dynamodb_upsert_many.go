@@ -0,0 +1,227 @@
+package lddynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TransactWriteItems accepts at most this many items per request, with at most this many bytes in total.
+const (
+	transactWriteMaxItems = 100
+	transactWriteMaxBytes = 4 * 1024 * 1024
+)
+
+// UpsertItem is one item to be written by [BatchUpserter.UpsertMany].
+type UpsertItem struct {
+	// Kind is the kind of data, such as feature flags or segments.
+	Kind ldstoretypes.DataKind
+	// Key is the item's key.
+	Key string
+	// Item is the versioned item to store.
+	Item ldstoretypes.SerializedItemDescriptor
+}
+
+// UpsertManyResult describes the outcome of [BatchUpserter.UpsertMany].
+type UpsertManyResult struct {
+	// Applied contains the items that were written.
+	Applied []UpsertItem
+	// Lost contains the items that were not written because the store already had the same or a
+	// higher version of the item.
+	Lost []UpsertItem
+}
+
+// BatchUpserter is implemented by the data store that is created by [DataStore], for applications
+// that want to update several items at once. The stores created by [ReplicatedDataStore] and
+// [MigrationDataStore] do not implement it, since they could not update all of their underlying stores
+// atomically.
+type BatchUpserter interface {
+	// UpsertMany writes several items, each one only if the store does not already have the same or a
+	// higher version of it, as Upsert does for a single item. The writes are done atomically with
+	// DynamoDB transactions, so readers never see some of the items updated and others not.
+	// DynamoDB limits a transaction to 100 items and 4MB, so if the items exceed either limit, they are
+	// split into groups that are each atomic, but that are written one after another.
+	//
+	// Items that lose the version race do not stop the others from being written; they are left out of
+	// the transaction and reported in the result's Lost list. If the same key appears more than once,
+	// only the highest version is written. Items that are too large to store are logged and left out
+	// of both lists. If this instance does not hold the writer lease (see [StoreBuilder.WriterLease]),
+	// or if the store is read-only (see [StoreBuilder.ReadOnly]), no items are written and all of them
+	// are reported as lost, unless [StoreBuilder.ReadOnlyWithErrors] was used, in which case it
+	// returns an error.
+	UpsertMany(items []UpsertItem) (UpsertManyResult, error)
+}
+
+type encodedUpsertItem struct {
+	item  UpsertItem
+	table string
+	av    map[string]types.AttributeValue
+}
+
+func (store *dynamoDBDataStore) UpsertMany(items []UpsertItem) (UpsertManyResult, error) {
+	ctx, span := store.tracer.start(store.context, "UpsertMany", "")
+	span.setKeyCount(len(items))
+	result, err := store.upsertMany(ctx, items)
+	err = classifyError(store.context, err)
+	span.endUpdate(err, len(result.Lost) == 0)
+	return result, err
+}
+
+func (store *dynamoDBDataStore) upsertMany(ctx context.Context, items []UpsertItem) (UpsertManyResult, error) {
+	var result UpsertManyResult
+	if store.readOnly && store.readOnlyErrors {
+		return result, fmt.Errorf("failed to write %d item(s): %w", len(items), ErrReadOnly)
+	}
+	if store.readOnly || !store.isWriter() {
+		result.Lost = append(result.Lost, items...)
+		return result, nil
+	}
+	if store.lease.mustInit() {
+		return result, fmt.Errorf("failed to write %d item(s): %w", len(items), errWriterNeedsInit)
+	}
+	if err := store.checkUpsertEnvironment(ctx); err != nil {
+		return result, fmt.Errorf("failed to write %d item(s): %w", len(items), err)
+	}
+
+	// A transaction can't contain more than one write to the same item, so if a key is repeated we
+	// only keep its highest version.
+	type kindAndKey struct {
+		kind string
+		key  string
+	}
+	latest := make(map[kindAndKey]int)
+	for i, item := range items {
+		kk := kindAndKey{item.Kind.GetName(), item.Key}
+		if j, ok := latest[kk]; !ok || item.Item.Version > items[j].Item.Version {
+			latest[kk] = i
+		}
+	}
+
+	var encoded []encodedUpsertItem
+	for i, item := range items {
+		if latest[kindAndKey{item.Kind.GetName(), item.Key}] != i {
+			result.Lost = append(result.Lost, item)
+			continue
+		}
+		av, err := store.encodeItem(item.Kind, item.Key, item.Item)
+		if err != nil {
+			return result, fmt.Errorf("failed to encode %s key %s: %w", item.Kind, item.Key, err)
+		}
+		if !store.checkSizeLimit(av, store.tableForKind(item.Kind), "TransactWriteItems") {
+			continue
+		}
+		encoded = append(encoded, encodedUpsertItem{item: item, table: store.tableForKind(item.Kind), av: av})
+	}
+
+	if len(encoded) > 0 {
+		if err := store.clearInitDataHash(ctx); err != nil {
+			return result, fmt.Errorf("failed to write %d item(s): %w", len(encoded), err)
+		}
+		if store.packedSnapshot {
+			if err := store.markPackedSnapshotStale(ctx); err != nil {
+				return result, fmt.Errorf("failed to mark packed snapshot as stale before writing %d item(s): %w",
+					len(encoded), err)
+			}
+		}
+	}
+
+	var err error
+	for len(encoded) > 0 && err == nil {
+		chunkSize := transactionChunkSize(encoded)
+		var applied, lost []UpsertItem
+		applied, lost, err = store.upsertTransaction(ctx, encoded[:chunkSize])
+		result.Applied = append(result.Applied, applied...)
+		result.Lost = append(result.Lost, lost...)
+		encoded = encoded[chunkSize:]
+	}
+	return result, err
+}
+
+// transactionChunkSize returns how many of the items, starting from the first, fit in one transaction.
+func transactionChunkSize(items []encodedUpsertItem) int {
+	size := 0
+	for i, item := range items {
+		size += itemSize(item.av)
+		if i == transactWriteMaxItems || (i > 0 && size > transactWriteMaxBytes) {
+			return i
+		}
+	}
+	return len(items)
+}
+
+// upsertTransaction writes items that fit within the limits of one transaction. If DynamoDB cancels the
+// transaction because some of the version conditions failed, it tries again without those items.
+func (store *dynamoDBDataStore) upsertTransaction(ctx context.Context, items []encodedUpsertItem) (
+	applied []UpsertItem, lost []UpsertItem, err error) {
+	for len(items) > 0 {
+		transactItems := make([]types.TransactWriteItem, 0, len(items))
+		units := 0.0
+		for _, item := range items {
+			transactItems = append(transactItems, types.TransactWriteItem{Put: &types.Put{
+				TableName: aws.String(item.table),
+				Item:      item.av,
+				ConditionExpression: aws.String(
+					"attribute_not_exists(#namespace) or " +
+						"attribute_not_exists(#key) or " +
+						":version > #version",
+				),
+				ExpressionAttributeNames: map[string]string{
+					"#namespace": tablePartitionKey,
+					"#key":       tableSortKey,
+					"#version":   versionAttribute,
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":version": attrValueOfInt(item.item.Item.Version),
+				},
+			}})
+			// Transactional writes use twice as much capacity as ordinary ones.
+			units += 2 * writeCapacityUnits(itemSize(item.av))
+		}
+		if err := store.writeLimiter.wait(ctx, units); err != nil {
+			return applied, lost, err // COVERAGE: can't cause this in unit tests
+		}
+
+		_, err := store.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: transactItems,
+		}, store.apiOptions...)
+		if err == nil {
+			for _, item := range items {
+				applied = append(applied, item.item)
+			}
+			return applied, lost, nil
+		}
+
+		var canceledErr *types.TransactionCanceledException
+		if !errors.As(err, &canceledErr) || len(canceledErr.CancellationReasons) != len(items) {
+			return applied, lost, fmt.Errorf("failed to write %d item(s) in a transaction: %w", len(items), err)
+		}
+		var remaining []encodedUpsertItem
+		for i, reason := range canceledErr.CancellationReasons {
+			switch aws.ToString(reason.Code) {
+			case "ConditionalCheckFailed":
+				if store.loggers.IsDebugEnabled() { // COVERAGE: tests don't verify debug logging
+					store.loggers.Debugf("Not updating item due to condition (namespace=%s key=%s version=%d)",
+						items[i].item.Kind, items[i].item.Key, items[i].item.Item.Version)
+				}
+				lost = append(lost, items[i].item)
+			case "", "None":
+				remaining = append(remaining, items[i])
+			default:
+				// COVERAGE: can't cause this in unit tests
+				return applied, lost, fmt.Errorf("failed to write %d item(s) in a transaction: %w", len(items), err)
+			}
+		}
+		if len(remaining) == len(items) {
+			// COVERAGE: can't cause this in unit tests; DynamoDB always gives a reason for cancelling
+			return applied, lost, fmt.Errorf("failed to write %d item(s) in a transaction: %w", len(items), err)
+		}
+		items = remaining
+	}
+	return applied, lost, nil
+}
@@ -0,0 +1,90 @@
+package lddynamodb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataStoreUpsertMany(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	makeItem := func(kind ldstoretypes.DataKind, key string, version int) UpsertItem {
+		return UpsertItem{Kind: kind, Key: key, Item: ldstoretypes.SerializedItemDescriptor{
+			Version: version, SerializedItem: []byte(fmt.Sprintf(`{"key": "%s", "version": %d}`, key, version)),
+		}}
+	}
+	makeStore := func(t *testing.T) BatchUpserter {
+		store, err := baseDataStoreBuilder().Build(subsystems.BasicClientContext{})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		return store.(BatchUpserter)
+	}
+	getVersion := func(t *testing.T, store BatchUpserter, kind ldstoretypes.DataKind, key string) int {
+		item, err := store.(subsystems.PersistentDataStore).Get(kind, key)
+		require.NoError(t, err)
+		return item.Version
+	}
+
+	t.Run("applies newer items and reports older ones as lost", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store := makeStore(t)
+		flag1v2, seg1v1 := makeItem(ldstoreimpl.Features(), "flag1", 2), makeItem(ldstoreimpl.Segments(), "seg1", 1)
+		result, err := store.UpsertMany([]UpsertItem{flag1v2, seg1v1})
+		require.NoError(t, err)
+		assert.Equal(t, []UpsertItem{flag1v2, seg1v1}, result.Applied)
+		assert.Len(t, result.Lost, 0)
+
+		flag1v1 := makeItem(ldstoreimpl.Features(), "flag1", 1)
+		flag2v1 := makeItem(ldstoreimpl.Features(), "flag2", 1)
+		seg1v3 := makeItem(ldstoreimpl.Segments(), "seg1", 3)
+		seg1v2 := makeItem(ldstoreimpl.Segments(), "seg1", 2)
+		result, err = store.UpsertMany([]UpsertItem{flag1v1, flag2v1, seg1v3, seg1v2})
+		require.NoError(t, err)
+		assert.Equal(t, []UpsertItem{flag2v1, seg1v3}, result.Applied)
+		assert.ElementsMatch(t, []UpsertItem{flag1v1, seg1v2}, result.Lost)
+
+		assert.Equal(t, 2, getVersion(t, store, ldstoreimpl.Features(), "flag1"))
+		assert.Equal(t, 1, getVersion(t, store, ldstoreimpl.Features(), "flag2"))
+		assert.Equal(t, 3, getVersion(t, store, ldstoreimpl.Segments(), "seg1"))
+	})
+
+	t.Run("writes more items than fit in one transaction", func(t *testing.T) {
+		require.NoError(t, clearTestData(""))
+		store := makeStore(t)
+		var items []UpsertItem
+		for i := 0; i < transactWriteMaxItems*2+10; i++ {
+			items = append(items, makeItem(ldstoreimpl.Features(), fmt.Sprintf("flag%03d", i), 1))
+		}
+		result, err := store.UpsertMany(items)
+		require.NoError(t, err)
+		assert.Equal(t, items, result.Applied)
+
+		all, err := store.(subsystems.PersistentDataStore).GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		assert.Len(t, all, len(items))
+	})
+}
+
+func TestTransactionChunkSize(t *testing.T) {
+	makeItems := func(count, bytes int) []encodedUpsertItem {
+		items := make([]encodedUpsertItem, count)
+		for i := range items {
+			items[i].av = map[string]types.AttributeValue{"v": attrValueOfString(strings.Repeat("x", bytes-1))}
+		}
+		return items
+	}
+
+	assert.Equal(t, 5, transactionChunkSize(makeItems(5, 100)))
+	assert.Equal(t, transactWriteMaxItems, transactionChunkSize(makeItems(transactWriteMaxItems+1, 100)))
+	assert.Equal(t, 10, transactionChunkSize(makeItems(15, 400*1024))) // 11 items would exceed 4MB
+	assert.Equal(t, 1, transactionChunkSize(makeItems(2, transactWriteMaxBytes)))
+}
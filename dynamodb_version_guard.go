@@ -0,0 +1,42 @@
+package lddynamodb
+
+import (
+	"fmt"
+)
+
+// VersionRegressionPolicy determines what the data store does when it is asked to initialize itself
+// with a data set that contains an older version of an item than the one already in the table. See
+// [StoreBuilder.VersionRegressionPolicy].
+type VersionRegressionPolicy int
+
+const (
+	// VersionRegressionAllow means that the data set replaces the stored items regardless of their
+	// versions. This is the default.
+	VersionRegressionAllow VersionRegressionPolicy = iota
+
+	// VersionRegressionSkip means that older items in the data set are not written, so the newer
+	// stored items are kept, while the rest of the data set is written as usual.
+	VersionRegressionSkip
+
+	// VersionRegressionRefuse means that if any item in the data set is older than the stored item,
+	// the data store does not write anything and returns an error.
+	VersionRegressionRefuse
+)
+
+// logVersionRegressions logs each item that Init is not writing because the store has a newer version
+// of it.
+func (store *dynamoDBDataStore) logVersionRegressions(items []InitPlanItem) {
+	action := "not writing it"
+	if store.versionRegressionPolicy == VersionRegressionRefuse {
+		action = "refusing to initialize the store"
+	}
+	for _, item := range items {
+		store.loggers.Warnf("Init data has version %d of %s key %s, but the store has version %d; %s",
+			item.Version, item.Kind, item.Key, item.StoredVersion, action)
+	}
+}
+
+func versionRegressionError(count int) error {
+	return fmt.Errorf("refused to initialize the store, because %d item(s) would have been replaced with older"+
+		" versions: %w", count, ErrVersionRegression)
+}
@@ -0,0 +1,75 @@
+package lddynamodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/launchdarkly/go-sdk-common/v3/ldlog"
+	"github.com/launchdarkly/go-sdk-common/v3/ldlogtest"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoreimpl"
+	"github.com/launchdarkly/go-server-sdk/v7/subsystems/ldstoretypes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataStoreVersionRegressionPolicy(t *testing.T) {
+	require.NoError(t, createTableIfNecessary())
+
+	makeData := func(versions map[string]int) []ldstoretypes.SerializedCollection {
+		var items []ldstoretypes.KeyedSerializedItemDescriptor
+		for _, key := range []string{"flag1", "flag2", "flag3"} {
+			if version, ok := versions[key]; ok {
+				items = append(items, ldstoretypes.KeyedSerializedItemDescriptor{Key: key,
+					Item: ldstoretypes.SerializedItemDescriptor{Version: version, SerializedItem: []byte(`{}`)}})
+			}
+		}
+		return []ldstoretypes.SerializedCollection{{Kind: ldstoreimpl.Features(), Items: items}}
+	}
+	storedData := makeData(map[string]int{"flag1": 2, "flag2": 2, "flag3": 1})
+	olderData := makeData(map[string]int{"flag1": 1, "flag2": 3})
+
+	initAndGetVersions := func(t *testing.T, policy VersionRegressionPolicy) (map[string]int, *ldlogtest.MockLog, error) {
+		require.NoError(t, clearTestData(""))
+		mockLog := ldlogtest.NewMockLog()
+		ctx := subsystems.BasicClientContext{}
+		ctx.Logging.Loggers = mockLog.Loggers
+		store, err := baseDataStoreBuilder().VersionRegressionPolicy(policy).Build(ctx)
+		require.NoError(t, err)
+		defer store.Close()
+
+		require.NoError(t, store.Init(storedData))
+		initErr := store.Init(olderData)
+
+		items, err := store.GetAll(ldstoreimpl.Features())
+		require.NoError(t, err)
+		versions := make(map[string]int)
+		for _, item := range items {
+			versions[item.Key] = item.Item.Version
+		}
+		return versions, mockLog, initErr
+	}
+
+	t.Run("allow", func(t *testing.T) {
+		versions, _, err := initAndGetVersions(t, VersionRegressionAllow)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"flag1": 1, "flag2": 3}, versions)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		versions, mockLog, err := initAndGetVersions(t, VersionRegressionSkip)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"flag1": 2, "flag2": 3}, versions)
+		assert.True(t, mockLog.HasMessageMatch(ldlog.Warn,
+			"version 1 of features key flag1, but the store has version 2; not writing it"))
+	})
+
+	t.Run("refuse", func(t *testing.T) {
+		versions, mockLog, err := initAndGetVersions(t, VersionRegressionRefuse)
+		assert.True(t, errors.Is(err, ErrVersionRegression))
+		assert.Equal(t, map[string]int{"flag1": 2, "flag2": 2, "flag3": 1}, versions)
+		assert.True(t, mockLog.HasMessageMatch(ldlog.Warn,
+			"version 1 of features key flag1, but the store has version 2; refusing to initialize the store"))
+	})
+}
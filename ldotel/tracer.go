@@ -0,0 +1,94 @@
+// Package ldotel provides an OpenTelemetry implementation of the lddynamodb.Tracer interface, for
+// tracing the operations of the LaunchDarkly DynamoDB integration.
+//
+// It is a separate module, so that applications that do not use it do not depend on OpenTelemetry.
+package ldotel
+
+import (
+	"context"
+
+	lddynamodb "github.com/launchdarkly/go-server-sdk-dynamodb/v4"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/launchdarkly/go-server-sdk-dynamodb/v4"
+
+// Attributes of the spans
+const (
+	attrTable                    = attribute.Key("aws.dynamodb.table_names")
+	attrPrefix                   = attribute.Key("launchdarkly.dynamodb.prefix")
+	attrKind                     = attribute.Key("launchdarkly.dynamodb.kind")
+	attrKeyCount                 = attribute.Key("launchdarkly.dynamodb.key_count")
+	attrConsumedCapacity         = attribute.Key("launchdarkly.dynamodb.consumed_capacity")
+	attrConditionalCheckFailures = attribute.Key("launchdarkly.dynamodb.conditional_check_failures")
+	attrOutcome                  = attribute.Key("launchdarkly.dynamodb.outcome")
+)
+
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+// NewTracer returns an implementation of lddynamodb.Tracer that creates OpenTelemetry spans with the
+// specified provider. Pass it to StoreBuilder.Tracer.
+//
+// The spans are of kind "client", and have these attributes:
+//
+//   - db.system: "dynamodb"
+//   - aws.dynamodb.table_names: the table name
+//   - launchdarkly.dynamodb.prefix: the store's key prefix
+//   - launchdarkly.dynamodb.kind: the data kind, for operations that are for one kind
+//   - launchdarkly.dynamodb.key_count: the number of keys, for operations that are for specific keys
+//   - launchdarkly.dynamodb.consumed_capacity: the DynamoDB capacity units consumed
+//   - launchdarkly.dynamodb.conditional_check_failures: the number of writes rejected by conditions
+//   - launchdarkly.dynamodb.outcome: "success", "not_updated", "conditional_check_failed", or "error"
+//
+// If the operation fails, the error is recorded and the span's status is set to Error. If provider is
+// nil, it returns nil, which disables tracing.
+func NewTracer(provider trace.TracerProvider) lddynamodb.Tracer {
+	if provider == nil {
+		return nil
+	}
+	return &otelTracer{
+		tracer: provider.Tracer(tracerName, trace.WithInstrumentationVersion(lddynamodb.Version)),
+	}
+}
+
+func (t *otelTracer) StartSpan(
+	ctx context.Context,
+	name string,
+	attributes lddynamodb.SpanAttributes,
+) (context.Context, lddynamodb.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "dynamodb"),
+		attrTable.StringSlice([]string{attributes.Table}),
+		attrPrefix.String(attributes.Prefix),
+	}
+	if attributes.Kind != "" {
+		attrs = append(attrs, attrKind.String(attributes.Kind))
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, &otelSpan{span: span}
+}
+
+func (s *otelSpan) End(result lddynamodb.SpanResult) {
+	if result.KeyCount >= 0 {
+		s.span.SetAttributes(attrKeyCount.Int(result.KeyCount))
+	}
+	s.span.SetAttributes(
+		attrConsumedCapacity.Float64(result.ConsumedCapacity),
+		attrConditionalCheckFailures.Int(result.ConditionalCheckFailures),
+		attrOutcome.String(result.Outcome),
+	)
+	if result.Err != nil {
+		s.span.RecordError(result.Err)
+		s.span.SetStatus(codes.Error, result.Err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,102 @@
+package ldotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	lddynamodb "github.com/launchdarkly/go-server-sdk-dynamodb/v4"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer(t *testing.T) {
+	makeTracer := func(t *testing.T) (lddynamodb.Tracer, *tracetest.SpanRecorder) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+		return NewTracer(provider), recorder
+	}
+	// lastSpan returns the attributes and status of the most recently ended span.
+	lastSpan := func(t *testing.T, recorder *tracetest.SpanRecorder, name string) (map[attribute.Key]attribute.Value,
+		sdktrace.Status) {
+		spans := recorder.Ended()
+		require.NotEmpty(t, spans)
+		span := spans[len(spans)-1]
+		require.Equal(t, name, span.Name())
+		assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+		attrs := make(map[attribute.Key]attribute.Value)
+		for _, attr := range span.Attributes() {
+			attrs[attr.Key] = attr.Value
+		}
+		return attrs, span.Status()
+	}
+
+	t.Run("successful operation", func(t *testing.T) {
+		tracer, recorder := makeTracer(t)
+		ctx, span := tracer.StartSpan(context.Background(), "DynamoDBDataStore.GetAll",
+			lddynamodb.SpanAttributes{Table: "t", Prefix: "p", Kind: "features"})
+		assert.True(t, trace.SpanContextFromContext(ctx).IsValid())
+		span.End(lddynamodb.SpanResult{KeyCount: 2, ConsumedCapacity: 1.5,
+			Outcome: lddynamodb.SpanOutcomeSuccess})
+
+		attrs, status := lastSpan(t, recorder, "DynamoDBDataStore.GetAll")
+		assert.Equal(t, codes.Unset, status.Code)
+		assert.Equal(t, "dynamodb", attrs["db.system"].AsString())
+		assert.Equal(t, []string{"t"}, attrs[attrTable].AsStringSlice())
+		assert.Equal(t, "p", attrs[attrPrefix].AsString())
+		assert.Equal(t, "features", attrs[attrKind].AsString())
+		assert.Equal(t, int64(2), attrs[attrKeyCount].AsInt64())
+		assert.Equal(t, 1.5, attrs[attrConsumedCapacity].AsFloat64())
+		assert.Equal(t, int64(0), attrs[attrConditionalCheckFailures].AsInt64())
+		assert.Equal(t, lddynamodb.SpanOutcomeSuccess, attrs[attrOutcome].AsString())
+	})
+
+	t.Run("operation without kind or keys", func(t *testing.T) {
+		tracer, recorder := makeTracer(t)
+		_, span := tracer.StartSpan(context.Background(), "DynamoDBDataStore.IsInitialized",
+			lddynamodb.SpanAttributes{Table: "t"})
+		span.End(lddynamodb.SpanResult{KeyCount: -1, Outcome: lddynamodb.SpanOutcomeSuccess})
+
+		attrs, _ := lastSpan(t, recorder, "DynamoDBDataStore.IsInitialized")
+		assert.NotContains(t, attrs, attrKind)
+		assert.NotContains(t, attrs, attrKeyCount)
+	})
+
+	t.Run("conditional check failure", func(t *testing.T) {
+		tracer, recorder := makeTracer(t)
+		_, span := tracer.StartSpan(context.Background(), "DynamoDBDataStore.Upsert",
+			lddynamodb.SpanAttributes{Table: "t", Kind: "features"})
+		span.End(lddynamodb.SpanResult{KeyCount: 1, ConditionalCheckFailures: 1,
+			Outcome: lddynamodb.SpanOutcomeConditionalCheckFailed})
+
+		attrs, status := lastSpan(t, recorder, "DynamoDBDataStore.Upsert")
+		assert.Equal(t, codes.Unset, status.Code)
+		assert.Equal(t, int64(1), attrs[attrConditionalCheckFailures].AsInt64())
+		assert.Equal(t, lddynamodb.SpanOutcomeConditionalCheckFailed, attrs[attrOutcome].AsString())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tracer, recorder := makeTracer(t)
+		_, span := tracer.StartSpan(context.Background(), "DynamoDBDataStore.Get",
+			lddynamodb.SpanAttributes{Table: "t", Kind: "features"})
+		span.End(lddynamodb.SpanResult{KeyCount: 1, Outcome: lddynamodb.SpanOutcomeError, Err: errors.New("sorry")})
+
+		attrs, status := lastSpan(t, recorder, "DynamoDBDataStore.Get")
+		assert.Equal(t, codes.Error, status.Code)
+		assert.Equal(t, "sorry", status.Description)
+		assert.Equal(t, lddynamodb.SpanOutcomeError, attrs[attrOutcome].AsString())
+		spans := recorder.Ended()
+		require.Len(t, spans[len(spans)-1].Events(), 1) // the recorded error
+	})
+
+	t.Run("nil provider disables tracing", func(t *testing.T) {
+		assert.Nil(t, NewTracer(nil))
+	})
+}
@@ -0,0 +1,131 @@
+// Package ldprometheus provides a Prometheus implementation of the lddynamodb.Metrics interface, for
+// monitoring the DynamoDB requests made by the LaunchDarkly DynamoDB integration.
+//
+// It is a separate module, so that applications that do not use it do not depend on the Prometheus
+// client.
+package ldprometheus
+
+import (
+	"errors"
+	"time"
+
+	lddynamodb "github.com/launchdarkly/go-server-sdk-dynamodb/v4"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "launchdarkly_dynamodb"
+
+var labelNames = []string{"table", "prefix", "operation"}
+
+type prometheusMetrics struct {
+	requestDuration          *prometheus.HistogramVec
+	errors                   *prometheus.CounterVec
+	conditionalCheckFailures *prometheus.CounterVec
+	itemsTooLarge            *prometheus.CounterVec
+	batchRetries             *prometheus.CounterVec
+	unprocessedItems         *prometheus.CounterVec
+}
+
+// NewMetrics creates the collectors for the DynamoDB stores' measurements, registers them with the
+// specified Registerer, and returns an implementation of lddynamodb.Metrics that updates them. Pass
+// it to StoreBuilder.Metrics.
+//
+// The metrics are:
+//
+//   - launchdarkly_dynamodb_request_duration_seconds: a histogram of the duration of DynamoDB requests
+//   - launchdarkly_dynamodb_errors_total: failed requests, with an additional "error_type" label
+//   - launchdarkly_dynamodb_conditional_check_failures_total: writes rejected by their conditions
+//   - launchdarkly_dynamodb_items_too_large_total: items dropped because they were too large
+//   - launchdarkly_dynamodb_batch_retries_total: retried BatchWriteItem requests
+//   - launchdarkly_dynamodb_unprocessed_items_total: items that BatchWriteItem did not process
+//
+// All of them have the labels "table", "prefix", and "operation". NewMetrics can be called more than
+// once with the same Registerer, for instance for a data store and a Big Segment store; the
+// collectors that are already registered are reused. If registerer is nil, it uses
+// prometheus.DefaultRegisterer.
+func NewMetrics(registerer prometheus.Registerer) (lddynamodb.Metrics, error) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	m := &prometheusMetrics{
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of DynamoDB requests, including retries done by the AWS SDK.",
+			Buckets:   prometheus.DefBuckets,
+		}, labelNames),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Number of DynamoDB requests that failed, by error type.",
+		}, append(append([]string(nil), labelNames...), "error_type")),
+		conditionalCheckFailures: newCounterVec("conditional_check_failures_total",
+			"Number of DynamoDB writes that were rejected because of their conditions."),
+		itemsTooLarge: newCounterVec("items_too_large_total",
+			"Number of items that were dropped because they were too large for DynamoDB."),
+		batchRetries: newCounterVec("batch_retries_total",
+			"Number of BatchWriteItem requests that were retried because of unprocessed items."),
+		unprocessedItems: newCounterVec("unprocessed_items_total",
+			"Number of items that BatchWriteItem requests did not process."),
+	}
+	var err error
+	m.requestDuration, err = register(registerer, m.requestDuration)
+	if err != nil {
+		return nil, err
+	}
+	for _, counter := range []**prometheus.CounterVec{&m.errors, &m.conditionalCheckFailures, &m.itemsTooLarge,
+		&m.batchRetries, &m.unprocessedItems} {
+		if *counter, err = register(registerer, *counter); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func newCounterVec(name, help string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, labelNames)
+}
+
+// register registers the collector, or returns the equivalent collector that is already registered.
+func register[C prometheus.Collector](registerer prometheus.Registerer, collector C) (C, error) {
+	err := registerer.Register(collector)
+	if err == nil {
+		return collector, nil
+	}
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		if existing, ok := alreadyRegistered.ExistingCollector.(C); ok {
+			return existing, nil
+		}
+	}
+	return collector, err
+}
+
+func labelValues(labels lddynamodb.MetricLabels, extra ...string) []string {
+	return append([]string{labels.Table, labels.Prefix, labels.Operation}, extra...)
+}
+
+func (m *prometheusMetrics) ObserveRequestDuration(labels lddynamodb.MetricLabels, duration time.Duration) {
+	m.requestDuration.WithLabelValues(labelValues(labels)...).Observe(duration.Seconds())
+}
+
+func (m *prometheusMetrics) IncrementErrors(labels lddynamodb.MetricLabels, errorType string) {
+	m.errors.WithLabelValues(labelValues(labels, errorType)...).Inc()
+}
+
+func (m *prometheusMetrics) IncrementConditionalCheckFailures(labels lddynamodb.MetricLabels, count int) {
+	m.conditionalCheckFailures.WithLabelValues(labelValues(labels)...).Add(float64(count))
+}
+
+func (m *prometheusMetrics) IncrementItemsTooLarge(labels lddynamodb.MetricLabels, count int) {
+	m.itemsTooLarge.WithLabelValues(labelValues(labels)...).Add(float64(count))
+}
+
+func (m *prometheusMetrics) IncrementBatchRetries(labels lddynamodb.MetricLabels) {
+	m.batchRetries.WithLabelValues(labelValues(labels)...).Inc()
+}
+
+func (m *prometheusMetrics) AddUnprocessedItems(labels lddynamodb.MetricLabels, count int) {
+	m.unprocessedItems.WithLabelValues(labelValues(labels)...).Add(float64(count))
+}
@@ -0,0 +1,67 @@
+package ldprometheus
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	lddynamodb "github.com/launchdarkly/go-server-sdk-dynamodb/v4"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	require.NoError(t, err)
+	other, err := NewMetrics(registry) // reuses the registered collectors
+	require.NoError(t, err)
+
+	labels := lddynamodb.MetricLabels{Table: "t", Prefix: "p", Operation: "BatchWriteItem"}
+	metrics.ObserveRequestDuration(labels, 20*time.Millisecond)
+	other.ObserveRequestDuration(labels, 30*time.Millisecond)
+	metrics.IncrementErrors(labels, "ProvisionedThroughputExceededException")
+	metrics.IncrementConditionalCheckFailures(labels, 2)
+	metrics.IncrementItemsTooLarge(labels, 1)
+	other.IncrementBatchRetries(labels)
+	other.AddUnprocessedItems(labels, 5)
+
+	assert.Equal(t, 1, testutil.CollectAndCount(registry, "launchdarkly_dynamodb_request_duration_seconds"))
+	expected := `
+# HELP launchdarkly_dynamodb_batch_retries_total Number of BatchWriteItem requests that were retried because of unprocessed items.
+# TYPE launchdarkly_dynamodb_batch_retries_total counter
+launchdarkly_dynamodb_batch_retries_total{operation="BatchWriteItem",prefix="p",table="t"} 1
+# HELP launchdarkly_dynamodb_conditional_check_failures_total Number of DynamoDB writes that were rejected because of their conditions.
+# TYPE launchdarkly_dynamodb_conditional_check_failures_total counter
+launchdarkly_dynamodb_conditional_check_failures_total{operation="BatchWriteItem",prefix="p",table="t"} 2
+# HELP launchdarkly_dynamodb_errors_total Number of DynamoDB requests that failed, by error type.
+# TYPE launchdarkly_dynamodb_errors_total counter
+launchdarkly_dynamodb_errors_total{error_type="ProvisionedThroughputExceededException",operation="BatchWriteItem",prefix="p",table="t"} 1
+# HELP launchdarkly_dynamodb_items_too_large_total Number of items that were dropped because they were too large for DynamoDB.
+# TYPE launchdarkly_dynamodb_items_too_large_total counter
+launchdarkly_dynamodb_items_too_large_total{operation="BatchWriteItem",prefix="p",table="t"} 1
+# HELP launchdarkly_dynamodb_unprocessed_items_total Number of items that BatchWriteItem requests did not process.
+# TYPE launchdarkly_dynamodb_unprocessed_items_total counter
+launchdarkly_dynamodb_unprocessed_items_total{operation="BatchWriteItem",prefix="p",table="t"} 5
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"launchdarkly_dynamodb_batch_retries_total",
+		"launchdarkly_dynamodb_conditional_check_failures_total",
+		"launchdarkly_dynamodb_errors_total",
+		"launchdarkly_dynamodb_items_too_large_total",
+		"launchdarkly_dynamodb_unprocessed_items_total",
+	))
+
+	var sampleCount uint64
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == "launchdarkly_dynamodb_request_duration_seconds" {
+			sampleCount = family.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	assert.Equal(t, uint64(2), sampleCount)
+}
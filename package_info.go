@@ -36,4 +36,9 @@
 // other data in the same table as long as you use the Prefix option to make each application
 // use different keys. However, it is advisable to configure separate tables in DynamoDB, for
 // better control over permissions and throughput.
+//
+// Some features, such as [InitInfoReader] and [CapacityStatsProvider], are provided through
+// interfaces that the stores implement in addition to the SDK's own store interfaces. The SDK does
+// not expose the stores that it creates, so to use one of these interfaces, an application calls
+// Build on the store's builder itself and does a type assertion on the result.
 package lddynamodb
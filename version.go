@@ -0,0 +1,6 @@
+package lddynamodb
+
+// Version is the current version string of this package. This is recorded in the table when the data
+// store is initialized (see [InitInfo]), and reported as the instrumentation version of traces. It must
+// be updated whenever a release is added to CHANGELOG.md; TestVersionMatchesChangeLog checks this.
+const Version = "4.0.0"
@@ -0,0 +1,20 @@
+package lddynamodb
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Version is maintained by hand, so this makes sure that it was updated along with the change log
+// when a release was made.
+func TestVersionMatchesChangeLog(t *testing.T) {
+	changeLog, err := os.ReadFile("CHANGELOG.md")
+	require.NoError(t, err)
+	latest := regexp.MustCompile(`(?m)^## \[([^\]]+)\]`).FindSubmatch(changeLog)
+	require.NotNil(t, latest, "change log has no release headings")
+	assert.Equal(t, string(latest[1]), Version)
+}